@@ -25,6 +25,9 @@ func main() {
 
 	fmt.Printf("Listening on %s ...\n", server.Addr())
 
+	// deletes expired keys that are never looked up again
+	go utils.RunActiveExpire()
+
 	for {
 		conn, err := server.Accept()
 		if err != nil {
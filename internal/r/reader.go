@@ -0,0 +1,338 @@
+package r
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// longest header line (e.g. "*3" or "$5") accepted from a client
+	maxLineLen = 64 * 1024
+	// https://redis.io/docs/reference/protocol-spec/#bulk-strings
+	maxBulkLen = 512 * 1024 * 1024
+	// matches the default of redis' client-query-buffer-limit
+	maxArrayLen = 1024 * 1024
+)
+
+// ProtocolError is returned when a client sends a malformed frame.
+// The connection can't be resynchronized after one of these.
+type ProtocolError struct {
+	msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.msg
+}
+
+func protocolErrorf(format string, a ...any) error {
+	return &ProtocolError{msg: fmt.Sprintf(format, a...)}
+}
+
+// Reader decodes client commands from a stream. A single command may
+// span many reads of the underlying connection.
+type Reader struct {
+	br *bufio.Reader
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{br: bufio.NewReader(rd)}
+}
+
+// HasCommand returns whether a whole command was already received, so that
+// ReadCommand returns it without waiting on the connection.
+func (rd *Reader) HasCommand() bool {
+	buffered, _ := rd.br.Peek(rd.br.Buffered())
+	for len(buffered) > 0 {
+		n, isCommand := frameLen(buffered)
+		if n == 0 {
+			return false
+		}
+		if isCommand {
+			return true
+		}
+		buffered = buffered[n:]
+	}
+	return false
+}
+
+// frameLen returns the length of the frame buffered starts with, 0 when it
+// wasn't fully received, and whether it is a command (empty arrays and
+// blank lines are skipped). A malformed frame counts as a command, as
+// ReadCommand reports it without waiting.
+func frameLen(buffered []byte) (int, bool) {
+	end := bytes.IndexByte(buffered, '\n')
+	if end < 0 {
+		return 0, false
+	}
+	if buffered[0] != '*' {
+		return end + 1, len(bytes.TrimSpace(buffered[:end])) > 0
+	}
+	arrayLen, err := strconv.ParseInt(string(bytes.TrimSuffix(buffered[1:end], []byte{'\r'})), 10, 64)
+	if err != nil {
+		return end + 1, true
+	}
+	n := end + 1
+	for i := int64(0); i < arrayLen; i++ {
+		rest := buffered[n:]
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			return 0, false
+		}
+		if rest[0] != '$' {
+			return n, true
+		}
+		bulkLen, err := strconv.ParseInt(string(bytes.TrimSuffix(rest[1:end], []byte{'\r'})), 10, 64)
+		if err != nil || bulkLen < 0 {
+			return n, true
+		}
+		// the header, the payload and its CRLF
+		n += end + 1 + int(bulkLen) + 2
+		if n > len(buffered) {
+			return 0, false
+		}
+	}
+	return n, arrayLen > 0
+}
+
+// Wait blocks until more data arrives, without consuming it, or the
+// connection fails, returning the error.
+func (rd *Reader) Wait() error {
+	_, err := rd.br.Peek(1)
+	return err
+}
+
+// https://redis.io/docs/reference/protocol-spec/#sending-commands-to-a-redis-server
+func (rd *Reader) ReadCommand() ([]string, error) {
+	for {
+		prefix, err := rd.br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if prefix != '*' {
+			rd.br.UnreadByte()
+			command, err := rd.readInlineCommand()
+			if err != nil {
+				return nil, err
+			}
+			// blank lines are ignored, like redis does
+			if len(command) == 0 {
+				continue
+			}
+			return command, nil
+		}
+
+		line, err := rd.readLine()
+		if err != nil {
+			return nil, err
+		}
+		arrayLen, err := strconv.ParseInt(string(line), 10, 64)
+		if err != nil || arrayLen > maxArrayLen {
+			return nil, protocolErrorf("invalid multibulk length")
+		}
+		// an empty (or null) array is not a command, wait for the next one
+		if arrayLen <= 0 {
+			continue
+		}
+
+		command := make([]string, 0, arrayLen)
+		for i := int64(0); i < arrayLen; i++ {
+			element, err := rd.readBulkString()
+			if err != nil {
+				return nil, err
+			}
+			command = append(command, element)
+		}
+		return command, nil
+	}
+}
+
+func (rd *Reader) readBulkString() (string, error) {
+	prefix, err := rd.br.ReadByte()
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if prefix != '$' {
+		return "", protocolErrorf("expected '$', got '%c'", prefix)
+	}
+
+	line, err := rd.readLine()
+	if err != nil {
+		return "", err
+	}
+	bulkLen, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil || bulkLen < 0 || bulkLen > maxBulkLen {
+		return "", protocolErrorf("invalid bulk length")
+	}
+
+	// the payload is length prefixed, so it may contain any byte (CRLF included)
+	buffer := make([]byte, bulkLen+2)
+	if _, err := io.ReadFull(rd.br, buffer); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if buffer[bulkLen] != '\r' || buffer[bulkLen+1] != '\n' {
+		return "", protocolErrorf("invalid bulk termination")
+	}
+	return string(buffer[:bulkLen]), nil
+}
+
+// https://redis.io/docs/reference/protocol-spec/#inline-commands
+func (rd *Reader) readInlineCommand() ([]string, error) {
+	var line []byte
+	for {
+		chunk, err := rd.br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineLen {
+			return nil, protocolErrorf("too big inline request")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		break
+	}
+
+	// telnet and netcat may send a bare LF instead of CRLF
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+	return splitArgs(line)
+}
+
+// splitArgs splits an inline command into arguments the way redis'
+// sdssplitargs does: arguments are separated by spaces, and may be wrapped
+// in "double quotes" (supporting \n, \r, \t, \b, \a, \\, \" and \xHH
+// escapes) or 'single quotes' (supporting only \').
+func splitArgs(line []byte) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg []byte
+		inDoubleQuotes, inSingleQuotes := false, false
+		for done := false; !done; {
+			if i == len(line) {
+				if inDoubleQuotes || inSingleQuotes {
+					return nil, protocolErrorf("unbalanced quotes in request")
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDoubleQuotes:
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					arg = append(arg, hexDigitToInt(line[i+2])<<4|hexDigitToInt(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if c == '"' {
+					// the closing quote must be followed by a space or nothing
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protocolErrorf("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			case inSingleQuotes:
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protocolErrorf("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			default:
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDoubleQuotes = true
+				case c == '\'':
+					inSingleQuotes = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			i++
+		}
+		args = append(args, string(arg))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func hexDigitToInt(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// readLine returns the next CRLF terminated line without the terminator.
+func (rd *Reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := rd.br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineLen {
+			return nil, protocolErrorf("too big header line")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		break
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, protocolErrorf("line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+// once part of a frame has been read, running out of input is an error
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
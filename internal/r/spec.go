@@ -2,10 +2,17 @@ package r
 
 import (
 	"fmt"
+	"math/big"
 )
 
 type Bytes = []byte
 
+// protocol versions a client can negotiate with HELLO
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
 // https://redis.io/docs/reference/protocol-spec/#simple-strings
 func ToSimpleString(value string) Bytes {
 	return Bytes(fmt.Sprintf("+%s\r\n", value))
@@ -22,6 +29,7 @@ func ToInteger(value int) Bytes {
 }
 
 // https://redis.io/docs/reference/protocol-spec/#bulk-strings
+// The length prefix counts bytes, so value may hold arbitrary binary data.
 func ToBulkString(value string) Bytes {
 	return Bytes(fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
 }
@@ -43,3 +51,67 @@ func ToNull() Bytes {
 func ToNullArray() Bytes {
 	return Bytes("*-1\r\n")
 }
+
+// https://redis.io/docs/reference/protocol-spec/#bulk-strings
+// RESP2's way of saying nil, RESP3 clients get ToNull instead.
+func ToNullBulkString() Bytes {
+	return Bytes("$-1\r\n")
+}
+
+// ToArrayOf wraps already encoded elements, which may be of mixed types,
+// in an array.
+func ToArrayOf(elements []Bytes) Bytes {
+	return aggregate('*', len(elements), elements)
+}
+
+// https://redis.io/docs/reference/protocol-spec/#maps
+// entries alternate between keys and their values.
+func ToMap(entries []Bytes) Bytes {
+	return aggregate('%', len(entries)/2, entries)
+}
+
+// https://redis.io/docs/reference/protocol-spec/#sets
+func ToSet(value []string) Bytes {
+	elements := make([]Bytes, 0, len(value))
+	for _, element := range value {
+		elements = append(elements, ToBulkString(element))
+	}
+	return aggregate('~', len(elements), elements)
+}
+
+// https://redis.io/docs/reference/protocol-spec/#pushes
+func ToPush(elements []Bytes) Bytes {
+	return aggregate('>', len(elements), elements)
+}
+
+// https://redis.io/docs/reference/protocol-spec/#doubles
+func ToDouble(value float64) Bytes {
+	return Bytes(fmt.Sprintf(",%s\r\n", FormatDouble(value)))
+}
+
+// https://redis.io/docs/reference/protocol-spec/#booleans
+func ToBoolean(value bool) Bytes {
+	if value {
+		return Bytes("#t\r\n")
+	}
+	return Bytes("#f\r\n")
+}
+
+// https://redis.io/docs/reference/protocol-spec/#big-numbers
+func ToBigNumber(value *big.Int) Bytes {
+	return Bytes(fmt.Sprintf("(%s\r\n", value.String()))
+}
+
+// https://redis.io/docs/reference/protocol-spec/#verbatim-strings
+// format is a three letter encoding such as "txt" or "mkd".
+func ToVerbatimString(format string, value string) Bytes {
+	return Bytes(fmt.Sprintf("=%d\r\n%s:%s\r\n", len(format)+1+len(value), format, value))
+}
+
+func aggregate(prefix byte, length int, elements []Bytes) Bytes {
+	output := Bytes(fmt.Sprintf("%c%d\r\n", prefix, length))
+	for _, element := range elements {
+		output = append(output, element...)
+	}
+	return output
+}
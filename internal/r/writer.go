@@ -0,0 +1,214 @@
+package r
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Error is a reply error with its own code instead of the generic ERR,
+// e.g. WRONGTYPE or NOPROTO.
+// https://redis.io/docs/reference/protocol-spec/#simple-errors
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + " " + e.Message
+}
+
+// Writer encodes replies in the protocol version the client negotiated.
+// Replies are buffered until Flush, so pipelined replies go out together.
+type Writer struct {
+	wr       io.Writer
+	buf      []byte
+	Protocol int
+}
+
+func NewWriter(wr io.Writer) *Writer {
+	return &Writer{wr: wr, Protocol: RESP2}
+}
+
+// Flush sends every buffered reply.
+func (w *Writer) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.wr.Write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// Buffered returns the replies written since the last Flush.
+func (w *Writer) Buffered() []byte {
+	return w.buf
+}
+
+func (w *Writer) WriteSimpleString(value string) {
+	w.buf = append(w.buf, '+')
+	w.buf = append(w.buf, value...)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+// WriteOK writes the +OK status most write commands reply with.
+func (w *Writer) WriteOK() {
+	w.WriteSimpleString("OK")
+}
+
+// WriteError writes err as an error reply. Errors are prefixed with ERR
+// unless err is an *Error carrying its own code.
+func (w *Writer) WriteError(err error) {
+	var replyErr *Error
+	w.buf = append(w.buf, '-')
+	if !errors.As(err, &replyErr) {
+		w.buf = append(w.buf, "ERR "...)
+	}
+	w.buf = append(w.buf, err.Error()...)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+func (w *Writer) WriteInteger(value int64) {
+	w.writeHeader(':', value)
+}
+
+func (w *Writer) WriteBulkString(value string) {
+	w.writeHeader('$', int64(len(value)))
+	w.buf = append(w.buf, value...)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+// WriteNull writes a nil bulk string (RESP2) or a null (RESP3).
+func (w *Writer) WriteNull() {
+	if w.Protocol == RESP3 {
+		w.buf = append(w.buf, ToNull()...)
+		return
+	}
+	w.buf = append(w.buf, ToNullBulkString()...)
+}
+
+// WriteNullArray writes a nil array (RESP2) or a null (RESP3).
+func (w *Writer) WriteNullArray() {
+	if w.Protocol == RESP3 {
+		w.buf = append(w.buf, ToNull()...)
+		return
+	}
+	w.buf = append(w.buf, ToNullArray()...)
+}
+
+// WriteArrayHeader starts an array, the next length replies are its elements.
+func (w *Writer) WriteArrayHeader(length int) {
+	w.writeHeader('*', int64(length))
+}
+
+// WriteMapHeader starts a map of length key/value pairs. RESP2 clients get
+// a flat array of 2*length elements.
+func (w *Writer) WriteMapHeader(length int) {
+	if w.Protocol == RESP3 {
+		w.writeHeader('%', int64(length))
+		return
+	}
+	w.writeHeader('*', int64(2*length))
+}
+
+// WriteSetHeader starts a set, RESP2 clients get an array.
+func (w *Writer) WriteSetHeader(length int) {
+	if w.Protocol == RESP3 {
+		w.writeHeader('~', int64(length))
+		return
+	}
+	w.writeHeader('*', int64(length))
+}
+
+// WritePushHeader starts an out of band push, RESP2 clients get an array.
+func (w *Writer) WritePushHeader(length int) {
+	if w.Protocol == RESP3 {
+		w.writeHeader('>', int64(length))
+		return
+	}
+	w.writeHeader('*', int64(length))
+}
+
+// WriteStringArray writes value as an array of bulk strings.
+func (w *Writer) WriteStringArray(value []string) {
+	w.WriteArrayHeader(len(value))
+	for _, element := range value {
+		w.WriteBulkString(element)
+	}
+}
+
+// WriteDouble writes value as a double, RESP2 clients get a bulk string.
+func (w *Writer) WriteDouble(value float64) {
+	if w.Protocol == RESP3 {
+		w.buf = append(w.buf, ToDouble(value)...)
+		return
+	}
+	w.WriteBulkString(FormatDouble(value))
+}
+
+// WriteBoolean writes value as a boolean, RESP2 clients get 1 or 0.
+func (w *Writer) WriteBoolean(value bool) {
+	if w.Protocol == RESP3 {
+		w.buf = append(w.buf, ToBoolean(value)...)
+		return
+	}
+	if value {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+}
+
+// WriteBigNumber writes value as a big number, RESP2 clients get a bulk string.
+func (w *Writer) WriteBigNumber(value *big.Int) {
+	if w.Protocol == RESP3 {
+		w.buf = append(w.buf, ToBigNumber(value)...)
+		return
+	}
+	w.WriteBulkString(value.String())
+}
+
+// WriteVerbatimString writes value as a verbatim string, RESP2 clients
+// get a bulk string.
+func (w *Writer) WriteVerbatimString(format string, value string) {
+	if w.Protocol == RESP3 {
+		w.buf = append(w.buf, ToVerbatimString(format, value)...)
+		return
+	}
+	w.WriteBulkString(value)
+}
+
+// WriteRaw appends an already encoded reply.
+func (w *Writer) WriteRaw(reply Bytes) {
+	w.buf = append(w.buf, reply...)
+}
+
+func (w *Writer) writeHeader(prefix byte, value int64) {
+	w.buf = append(w.buf, prefix)
+	w.buf = strconv.AppendInt(w.buf, value, 10)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+// FormatDouble formats value the way redis prints doubles.
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	// shortest representation, only large or tiny numbers use an exponent
+	if abs := math.Abs(value); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		// go pads the exponent to two digits, redis doesn't: 1e-7 not 1e-07
+		formatted := strconv.FormatFloat(value, 'g', -1, 64)
+		e := strings.IndexByte(formatted, 'e')
+		exponent := strings.TrimLeft(formatted[e+2:], "0")
+		return formatted[:e+2] + exponent
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+// Blocking commands (e.g. BLPOP) that find nothing to serve the client with
+// park it until another client pushes to one of its keys, or its timeout
+// expires. Clients blocked on the same key are served in the order they
+// blocked.
+// https://redis.io/commands/blpop/#blocking-behavior
+
+// serveFunc tries to serve a blocked client from key, writing the reply to
+// w, and returns whether it did. It runs under executionLock.
+type serveFunc func(w *r.Writer, key string) bool
+
+// keyType returns whether a value has the type a blocked client pops from.
+type keyType func(value any) bool
+
+func isList(value any) bool {
+	_, ok := value.(*deque)
+	return ok
+}
+
+func isZset(value any) bool {
+	_, ok := value.(*zset)
+	return ok
+}
+
+type blockedClient struct {
+	keys []string
+	// a key holding another type leaves the client blocked
+	keyType keyType
+	serve   serveFunc
+	// writes the reply sent when the timeout expires
+	timeoutReply func(w *r.Writer)
+	// 0 blocks forever
+	timeout time.Duration
+	// the reply written by serve, the client's own writer belongs to its
+	// goroutine
+	reply *r.Writer
+	// closed once the client is served
+	done chan struct{}
+	// whether the client was removed from blockingKeys
+	unblocked bool
+}
+
+var (
+	// clients blocked on each key, longest waiting first
+	blockingKeys = map[string][]*blockedClient{}
+	// keys pushed to by the running command, with clients blocked on them
+	readyKeys []string
+)
+
+// parseTimeout parses the timeout of a blocking command, in seconds.
+func parseTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errors.New("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, errors.New("timeout is negative")
+	}
+	if seconds > float64(math.MaxInt64)/float64(time.Second) {
+		return 0, errors.New("timeout is out of range")
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	// 0 blocks forever, which a tiny timeout must not truncate to
+	if timeout == 0 && seconds > 0 {
+		timeout = time.Nanosecond
+	}
+	return timeout, nil
+}
+
+// blockClient parks client on keys once the running command returns, until
+// serve succeeds for one of them (holding a value of keyType) or the timeout
+// expires.
+func blockClient(client *Client, w *r.Writer, keys []string, keyType keyType, timeout time.Duration, serve serveFunc, timeoutReply func(w *r.Writer)) {
+	b := &blockedClient{
+		keyType:      keyType,
+		serve:        serve,
+		timeoutReply: timeoutReply,
+		timeout:      timeout,
+		reply:        r.NewWriter(io.Discard),
+		done:         make(chan struct{}),
+	}
+	b.reply.Protocol = w.Protocol
+	for _, key := range keys {
+		// a key given twice is waited on once
+		if slices.Contains(b.keys, key) {
+			continue
+		}
+		b.keys = append(b.keys, key)
+		blockingKeys[key] = append(blockingKeys[key], b)
+	}
+	client.blocked = b
+}
+
+// unblock removes b from the keys it waits on, executionLock must be held.
+func (b *blockedClient) unblock() {
+	for _, key := range b.keys {
+		waiting := slices.DeleteFunc(blockingKeys[key], func(other *blockedClient) bool {
+			return other == b
+		})
+		if len(waiting) == 0 {
+			delete(blockingKeys, key)
+		} else {
+			blockingKeys[key] = waiting
+		}
+	}
+	b.unblocked = true
+}
+
+// cancel unblocks b unless it was served, for a client that disconnected.
+func (b *blockedClient) cancel() {
+	executionLock.Lock()
+	defer executionLock.Unlock()
+	if !b.unblocked {
+		b.unblock()
+	}
+}
+
+// signalKeyAsReady records that key was pushed to, so that the clients
+// blocked on it are served once the running command returns.
+func signalKeyAsReady(key string) {
+	if _, ok := blockingKeys[key]; ok && !slices.Contains(readyKeys, key) {
+		readyKeys = append(readyKeys, key)
+	}
+}
+
+// serveBlockedClients serves the clients blocked on the keys that became
+// ready, longest waiting first. It runs after every command, under
+// executionLock. Serving a client may make other keys ready (e.g. BLMOVE).
+// The clients waiting for another type than the key holds stay blocked,
+// instead of getting the WRONGTYPE error of their first attempt.
+func serveBlockedClients() {
+	for len(readyKeys) > 0 {
+		key := readyKeys[0]
+		readyKeys = readyKeys[1:]
+		for i := 0; i < len(blockingKeys[key]); {
+			b := blockingKeys[key][i]
+			value, ok := db.Load(key)
+			if !ok {
+				break
+			}
+			if !b.keyType(value) {
+				i++
+				continue
+			}
+			if !b.serve(b.reply, key) {
+				break
+			}
+			// unblock removes b from blockingKeys[key]
+			b.unblock()
+			close(b.done)
+		}
+	}
+}
+
+// waitUnblocked parks the goroutine of a client a command blocked until it
+// is served or its timeout expires, and writes its reply to w. The replies
+// already written to w are sent first. It returns false when the client
+// disconnected while blocked.
+func waitUnblocked(client *Client, w *r.Writer, reader *r.Reader) bool {
+	b := client.blocked
+	client.blocked = nil
+
+	if err := w.Flush(); err != nil {
+		b.cancel()
+		return false
+	}
+
+	var timeout <-chan time.Time
+	if b.timeout > 0 {
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// the connection is watched for a disconnect, commands the client
+	// pipelines meanwhile are read once it is unblocked
+	watcher := make(chan error, 1)
+	go func() {
+		watcher <- reader.Wait()
+	}()
+
+	for {
+		select {
+		case <-b.done:
+			w.WriteRaw(b.reply.Buffered())
+			client.watcher = watcher
+			return true
+
+		case <-timeout:
+			executionLock.Lock()
+			if !b.unblocked {
+				b.unblock()
+				executionLock.Unlock()
+				b.timeoutReply(w)
+				client.watcher = watcher
+				return true
+			}
+			// it was served meanwhile
+			executionLock.Unlock()
+
+		case err := <-watcher:
+			if err == nil {
+				watcher = nil
+				continue
+			}
+			b.cancel()
+			return false
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+// HandlerFunc executes a command (name included in args) and writes its
+// reply to w.
+type HandlerFunc func(client *Client, w *r.Writer, args []string)
+
+// https://redis.io/commands/command/#flags
+const (
+	FlagWrite    = "write"
+	FlagReadonly = "readonly"
+	FlagDenyOOM  = "denyoom"
+	FlagFast     = "fast"
+	FlagNoScript = "noscript"
+	FlagLoading  = "loading"
+	FlagStale    = "stale"
+	FlagBlocking = "blocking"
+	// the key positions can't describe every key, see Command.KeysFunc
+	FlagMovableKeys = "movablekeys"
+)
+
+// Command describes a command the way redis' command table does.
+// https://redis.io/commands/command/#reply
+type Command struct {
+	Name string
+	// the exact number of arguments (command name included), or the
+	// negated minimum for variadic commands
+	Arity int
+	Flags []string
+	// positions of the key arguments, a negative LastKey counts from the end
+	FirstKey int
+	LastKey  int
+	Step     int
+	// finds the keys of commands whose key positions depend on other
+	// arguments (e.g. a numkeys argument), nil for every other command
+	KeysFunc func(args []string) []string
+	Handler  HandlerFunc
+}
+
+var commands = map[string]*Command{}
+
+// register adds cmd to the command table, it is meant to be called from init.
+func register(cmd *Command) {
+	commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+func lookupCommand(name string) (*Command, bool) {
+	cmd, ok := commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+func (cmd *Command) checkArity(argc int) bool {
+	if cmd.Arity < 0 {
+		return argc >= -cmd.Arity
+	}
+	return argc == cmd.Arity
+}
+
+// keys returns the key arguments of args according to the key positions.
+func (cmd *Command) keys(args []string) []string {
+	if cmd.KeysFunc != nil {
+		return cmd.KeysFunc(args)
+	}
+	if cmd.FirstKey == 0 {
+		return nil
+	}
+	last := cmd.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	keys := []string{}
+	for i := cmd.FirstKey; i <= last && i < len(args); i += cmd.Step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+func (cmd *Command) writeInfo(w *r.Writer) {
+	w.WriteArrayHeader(10)
+	w.WriteBulkString(cmd.Name)
+	w.WriteInteger(int64(cmd.Arity))
+	w.WriteSetHeader(len(cmd.Flags))
+	for _, flag := range cmd.Flags {
+		w.WriteSimpleString(flag)
+	}
+	w.WriteInteger(int64(cmd.FirstKey))
+	w.WriteInteger(int64(cmd.LastKey))
+	w.WriteInteger(int64(cmd.Step))
+	// acl categories, tips, key specs and subcommands aren't tracked
+	w.WriteSetHeader(0)
+	w.WriteSetHeader(0)
+	w.WriteArrayHeader(0)
+	w.WriteArrayHeader(0)
+}
+
+// Commands run one at a time, the way they do on redis' single thread, so
+// every command (e.g. INCR's read-modify-write) is atomic.
+var executionLock sync.Mutex
+
+// Execute looks up the command named by args[0], checks its arity and runs it.
+func Execute(client *Client, w *r.Writer, args []string) {
+	cmd, ok := lookupCommand(args[0])
+	if !ok {
+		w.WriteError(fmt.Errorf("unknown command '%s'", args[0]))
+		return
+	}
+	if !cmd.checkArity(len(args)) {
+		w.WriteError(fmt.Errorf("wrong number of arguments for '%s' command", cmd.Name))
+		return
+	}
+
+	executionLock.Lock()
+	defer executionLock.Unlock()
+	cmd.Handler(client, w, args)
+	serveBlockedClients()
+}
+
+func init() {
+	register(&Command{Name: "command", Arity: -1, Flags: []string{FlagLoading, FlagStale}, Handler: HandleCOMMAND})
+	register(&Command{Name: "hello", Arity: -1, Flags: []string{FlagNoScript, FlagLoading, FlagStale, FlagFast}, Handler: HandleHELLO})
+	register(&Command{Name: "ping", Arity: -1, Flags: []string{FlagFast}, Handler: HandlePING})
+	register(&Command{Name: "echo", Arity: 2, Flags: []string{FlagFast}, Handler: HandleECHO})
+
+	register(&Command{Name: "get", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleGET})
+	register(&Command{Name: "set", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSET})
+	register(&Command{Name: "setnx", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSETNX})
+	register(&Command{Name: "setex", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSETEX})
+	register(&Command{Name: "psetex", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandlePSETEX})
+	register(&Command{Name: "getset", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleGETSET})
+	register(&Command{Name: "append", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleAPPEND})
+	register(&Command{Name: "strlen", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSTRLEN})
+	register(&Command{Name: "getrange", Arity: 4, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleGETRANGE})
+	register(&Command{Name: "setrange", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSETRANGE})
+	register(&Command{Name: "getdel", Arity: 2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleGETDEL})
+	register(&Command{Name: "getex", Arity: -2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleGETEX})
+	register(&Command{Name: "lcs", Arity: -3, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 2, Step: 1, Handler: HandleLCS})
+	register(&Command{Name: "setbit", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSETBIT})
+	register(&Command{Name: "getbit", Arity: 3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleGETBIT})
+	register(&Command{Name: "bitcount", Arity: -2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleBITCOUNT})
+	register(&Command{Name: "bitpos", Arity: -3, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleBITPOS})
+	register(&Command{Name: "bitop", Arity: -4, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 2, LastKey: -1, Step: 1, Handler: HandleBITOP})
+	register(&Command{Name: "bitfield", Arity: -2, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleBITFIELD})
+	register(&Command{Name: "bitfield_ro", Arity: -2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleBITFIELD_RO})
+	register(&Command{Name: "mget", Arity: -2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleMGET})
+	register(&Command{Name: "mset", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: -1, Step: 2, Handler: HandleMSET})
+	register(&Command{Name: "msetnx", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: -1, Step: 2, Handler: HandleMSETNX})
+	register(&Command{Name: "exists", Arity: -2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleEXISTS})
+	register(&Command{Name: "del", Arity: -2, Flags: []string{FlagWrite}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleDEL})
+	register(&Command{Name: "incr", Arity: 2, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleINCR})
+	register(&Command{Name: "decr", Arity: 2, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleDECR})
+	register(&Command{Name: "incrby", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleINCRBY})
+	register(&Command{Name: "decrby", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleDECRBY})
+	register(&Command{Name: "incrbyfloat", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleINCRBYFLOAT})
+
+	register(&Command{Name: "hset", Arity: -4, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHSET})
+	register(&Command{Name: "hsetnx", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHSETNX})
+	register(&Command{Name: "hget", Arity: 3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHGET})
+	register(&Command{Name: "hmget", Arity: -3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHMGET})
+	register(&Command{Name: "hdel", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHDEL})
+	register(&Command{Name: "hexists", Arity: 3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHEXISTS})
+	register(&Command{Name: "hlen", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHLEN})
+	register(&Command{Name: "hstrlen", Arity: 3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHSTRLEN})
+	register(&Command{Name: "hkeys", Arity: 2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHKEYS})
+	register(&Command{Name: "hvals", Arity: 2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHVALS})
+	register(&Command{Name: "hgetall", Arity: 2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHGETALL})
+	register(&Command{Name: "hincrby", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHINCRBY})
+	register(&Command{Name: "hincrbyfloat", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHINCRBYFLOAT})
+	register(&Command{Name: "hexpire", Arity: -6, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHEXPIRE})
+	register(&Command{Name: "hpexpire", Arity: -6, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHPEXPIRE})
+	register(&Command{Name: "hexpireat", Arity: -6, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHEXPIREAT})
+	register(&Command{Name: "hpexpireat", Arity: -6, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHPEXPIREAT})
+	register(&Command{Name: "httl", Arity: -5, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHTTL})
+	register(&Command{Name: "hpttl", Arity: -5, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHPTTL})
+	register(&Command{Name: "hexpiretime", Arity: -5, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHEXPIRETIME})
+	register(&Command{Name: "hpexpiretime", Arity: -5, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHPEXPIRETIME})
+	register(&Command{Name: "hpersist", Arity: -5, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleHPERSIST})
+
+	register(&Command{Name: "sadd", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSADD})
+	register(&Command{Name: "srem", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSREM})
+	register(&Command{Name: "sismember", Arity: 3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSISMEMBER})
+	register(&Command{Name: "smismember", Arity: -3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSMISMEMBER})
+	register(&Command{Name: "scard", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSCARD})
+	register(&Command{Name: "smembers", Arity: 2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSMEMBERS})
+	register(&Command{Name: "spop", Arity: -2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSPOP})
+	register(&Command{Name: "srandmember", Arity: -2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleSRANDMEMBER})
+	register(&Command{Name: "smove", Arity: 4, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 2, Step: 1, Handler: HandleSMOVE})
+	register(&Command{Name: "sinter", Arity: -2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleSINTER})
+	register(&Command{Name: "sunion", Arity: -2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleSUNION})
+	register(&Command{Name: "sdiff", Arity: -2, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleSDIFF})
+	register(&Command{Name: "sinterstore", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleSINTERSTORE})
+	register(&Command{Name: "sunionstore", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleSUNIONSTORE})
+	register(&Command{Name: "sdiffstore", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: -1, Step: 1, Handler: HandleSDIFFSTORE})
+	register(&Command{Name: "sintercard", Arity: -3, Flags: []string{FlagReadonly, FlagMovableKeys}, KeysFunc: mpopKeys(1), Handler: HandleSINTERCARD})
+
+	register(&Command{Name: "zadd", Arity: -4, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZADD})
+	register(&Command{Name: "zincrby", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZINCRBY})
+	register(&Command{Name: "zrem", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZREM})
+	register(&Command{Name: "zscore", Arity: 3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZSCORE})
+	register(&Command{Name: "zmscore", Arity: -3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZMSCORE})
+	register(&Command{Name: "zcard", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZCARD})
+	register(&Command{Name: "zcount", Arity: 4, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZCOUNT})
+	register(&Command{Name: "zrank", Arity: -3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZRANK})
+	register(&Command{Name: "zrevrank", Arity: -3, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZREVRANK})
+	register(&Command{Name: "zrange", Arity: -4, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZRANGE})
+	register(&Command{Name: "zrangestore", Arity: -5, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 2, Step: 1, Handler: HandleZRANGESTORE})
+	register(&Command{Name: "zunion", Arity: -3, Flags: []string{FlagReadonly, FlagMovableKeys}, KeysFunc: mpopKeys(1), Handler: HandleZUNION})
+	register(&Command{Name: "zinter", Arity: -3, Flags: []string{FlagReadonly, FlagMovableKeys}, KeysFunc: mpopKeys(1), Handler: HandleZINTER})
+	register(&Command{Name: "zdiff", Arity: -3, Flags: []string{FlagReadonly, FlagMovableKeys}, KeysFunc: mpopKeys(1), Handler: HandleZDIFF})
+	register(&Command{Name: "zunionstore", Arity: -4, Flags: []string{FlagWrite, FlagDenyOOM, FlagMovableKeys}, KeysFunc: zsetStoreKeys, Handler: HandleZUNIONSTORE})
+	register(&Command{Name: "zinterstore", Arity: -4, Flags: []string{FlagWrite, FlagDenyOOM, FlagMovableKeys}, KeysFunc: zsetStoreKeys, Handler: HandleZINTERSTORE})
+	register(&Command{Name: "zdiffstore", Arity: -4, Flags: []string{FlagWrite, FlagDenyOOM, FlagMovableKeys}, KeysFunc: zsetStoreKeys, Handler: HandleZDIFFSTORE})
+	register(&Command{Name: "zpopmin", Arity: -2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZPOPMIN})
+	register(&Command{Name: "zpopmax", Arity: -2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleZPOPMAX})
+	register(&Command{Name: "zmpop", Arity: -4, Flags: []string{FlagWrite, FlagMovableKeys}, KeysFunc: mpopKeys(1), Handler: HandleZMPOP})
+	register(&Command{Name: "bzpopmin", Arity: -3, Flags: []string{FlagWrite, FlagNoScript, FlagFast, FlagBlocking}, FirstKey: 1, LastKey: -2, Step: 1, Handler: HandleBZPOPMIN})
+	register(&Command{Name: "bzpopmax", Arity: -3, Flags: []string{FlagWrite, FlagNoScript, FlagFast, FlagBlocking}, FirstKey: 1, LastKey: -2, Step: 1, Handler: HandleBZPOPMAX})
+	register(&Command{Name: "bzmpop", Arity: -5, Flags: []string{FlagWrite, FlagBlocking, FlagMovableKeys}, KeysFunc: mpopKeys(2), Handler: HandleBZMPOP})
+
+	register(&Command{Name: "expire", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleEXPIRE})
+	register(&Command{Name: "pexpire", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandlePEXPIRE})
+	register(&Command{Name: "expireat", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleEXPIREAT})
+	register(&Command{Name: "pexpireat", Arity: -3, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandlePEXPIREAT})
+	register(&Command{Name: "ttl", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleTTL})
+	register(&Command{Name: "pttl", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandlePTTL})
+	register(&Command{Name: "expiretime", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleEXPIRETIME})
+	register(&Command{Name: "pexpiretime", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandlePEXPIRETIME})
+	register(&Command{Name: "persist", Arity: 2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandlePERSIST})
+
+	register(&Command{Name: "lpush", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLPUSH})
+	register(&Command{Name: "rpush", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleRPUSH})
+	register(&Command{Name: "lrange", Arity: 4, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLRANGE})
+	register(&Command{Name: "lpop", Arity: -2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLPOP})
+	register(&Command{Name: "rpop", Arity: -2, Flags: []string{FlagWrite, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleRPOP})
+	register(&Command{Name: "llen", Arity: 2, Flags: []string{FlagReadonly, FlagFast}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLLEN})
+	register(&Command{Name: "lindex", Arity: 3, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLINDEX})
+	register(&Command{Name: "lset", Arity: 4, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLSET})
+	register(&Command{Name: "linsert", Arity: 5, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLINSERT})
+	register(&Command{Name: "lrem", Arity: 4, Flags: []string{FlagWrite}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLREM})
+	register(&Command{Name: "ltrim", Arity: 4, Flags: []string{FlagWrite}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLTRIM})
+	register(&Command{Name: "lpos", Arity: -3, Flags: []string{FlagReadonly}, FirstKey: 1, LastKey: 1, Step: 1, Handler: HandleLPOS})
+	register(&Command{Name: "lmove", Arity: 5, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 2, Step: 1, Handler: HandleLMOVE})
+	register(&Command{Name: "rpoplpush", Arity: 3, Flags: []string{FlagWrite, FlagDenyOOM}, FirstKey: 1, LastKey: 2, Step: 1, Handler: HandleRPOPLPUSH})
+	register(&Command{Name: "lmpop", Arity: -4, Flags: []string{FlagWrite, FlagMovableKeys}, KeysFunc: mpopKeys(1), Handler: HandleLMPOP})
+	register(&Command{Name: "blpop", Arity: -3, Flags: []string{FlagWrite, FlagNoScript, FlagBlocking}, FirstKey: 1, LastKey: -2, Step: 1, Handler: HandleBLPOP})
+	register(&Command{Name: "brpop", Arity: -3, Flags: []string{FlagWrite, FlagNoScript, FlagBlocking}, FirstKey: 1, LastKey: -2, Step: 1, Handler: HandleBRPOP})
+	register(&Command{Name: "blmove", Arity: 6, Flags: []string{FlagWrite, FlagDenyOOM, FlagNoScript, FlagBlocking}, FirstKey: 1, LastKey: 2, Step: 1, Handler: HandleBLMOVE})
+	register(&Command{Name: "blmpop", Arity: -5, Flags: []string{FlagWrite, FlagBlocking, FlagMovableKeys}, KeysFunc: mpopKeys(2), Handler: HandleBLMPOP})
+}
+
+// https://redis.io/commands/command/
+func HandleCOMMAND(client *Client, w *r.Writer, args []string) {
+	if len(args) == 1 {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w.WriteArrayHeader(len(names))
+		for _, name := range names {
+			commands[name].writeInfo(w)
+		}
+		return
+	}
+
+	switch strings.ToUpper(args[1]) {
+	case "COUNT":
+		if len(args) != 2 {
+			w.WriteError(fmt.Errorf("wrong number of arguments for 'command|count' command"))
+			return
+		}
+		w.WriteInteger(int64(len(commands)))
+
+	case "INFO":
+		w.WriteArrayHeader(len(args) - 2)
+		for _, name := range args[2:] {
+			cmd, ok := lookupCommand(name)
+			if !ok {
+				w.WriteNullArray()
+				continue
+			}
+			cmd.writeInfo(w)
+		}
+
+	case "DOCS":
+		// there is no documentation to hand out, but redis-cli asks on startup
+		w.WriteMapHeader(0)
+
+	case "GETKEYS":
+		if len(args) < 3 {
+			w.WriteError(fmt.Errorf("wrong number of arguments for 'command|getkeys' command"))
+			return
+		}
+		cmd, ok := lookupCommand(args[2])
+		if !ok {
+			w.WriteError(fmt.Errorf("Invalid command specified"))
+			return
+		}
+		if !cmd.checkArity(len(args) - 2) {
+			w.WriteError(fmt.Errorf("Invalid number of arguments specified for command"))
+			return
+		}
+		keys := cmd.keys(args[2:])
+		if len(keys) == 0 {
+			w.WriteError(fmt.Errorf("The command has no key arguments"))
+			return
+		}
+		w.WriteStringArray(keys)
+
+	default:
+		w.WriteError(fmt.Errorf("unknown subcommand '%s'. Try COMMAND HELP.", args[1]))
+	}
+}
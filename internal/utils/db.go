@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// https://redis.io/commands/expire/#how-redis-expires-keys
+const (
+	// how often the active expire cycle runs (redis' hz 10)
+	activeExpireInterval = 100 * time.Millisecond
+	// keys with a TTL looked at per round
+	activeExpireSamples = 20
+	// another round runs while more than this share of the sample was expired
+	activeExpireThreshold = 0.25
+	// upper bound on the time a single cycle may hold the lock
+	activeExpireBudget = 25 * time.Millisecond
+)
+
+type entry struct {
+	value any
+	// unix time in milliseconds, 0 when the key never expires
+	expireAt int64
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+// keyspace is a goroutine (concurrency) safe key-value store in which every
+// key may carry an expiration time. Expired keys are removed lazily when
+// they're accessed, and in the background by the active expire cycle.
+type keyspace struct {
+	mu   sync.RWMutex
+	data map[string]*entry
+	// keys with an expiration time, sampled by the active expire cycle
+	expires map[string]struct{}
+}
+
+func newKeyspace() *keyspace {
+	return &keyspace{
+		data:    map[string]*entry{},
+		expires: map[string]struct{}{},
+	}
+}
+
+func now() int64 {
+	return time.Now().UnixMilli()
+}
+
+// lookup returns the live entry of key, ks.mu must be held.
+func (ks *keyspace) lookup(key string) (*entry, bool) {
+	e, ok := ks.data[key]
+	if !ok || e.expired(now()) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (ks *keyspace) delete(key string) {
+	delete(ks.data, key)
+	delete(ks.expires, key)
+}
+
+// Load returns the value of key, deleting it if it has expired.
+func (ks *keyspace) Load(key string) (any, bool) {
+	ks.mu.RLock()
+	e, ok := ks.data[key]
+	if !ok {
+		ks.mu.RUnlock()
+		return nil, false
+	}
+	if !e.expired(now()) {
+		value := e.value
+		ks.mu.RUnlock()
+		return value, true
+	}
+	ks.mu.RUnlock()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	// the key may have been written since the read lock was released
+	if e, ok := ks.lookup(key); ok {
+		return e.value, true
+	}
+	ks.delete(key)
+	return nil, false
+}
+
+// Store sets key to value, discarding any expiration time it had.
+func (ks *keyspace) Store(key string, value any) {
+	ks.StoreWithExpiry(key, value, 0)
+}
+
+// StoreWithExpiry sets key to value, expiring at expireAt (unix time in
+// milliseconds, 0 for never).
+func (ks *keyspace) StoreWithExpiry(key string, value any, expireAt int64) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.data[key] = &entry{value: value, expireAt: expireAt}
+	if expireAt != 0 {
+		ks.expires[key] = struct{}{}
+	} else {
+		delete(ks.expires, key)
+	}
+}
+
+// StoreKeepTTL sets key to value, keeping the expiration time of the value
+// it replaces, the way commands that modify a value (e.g. INCR) do.
+func (ks *keyspace) StoreKeepTTL(key string, value any) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if e, ok := ks.lookup(key); ok {
+		e.value = value
+		return
+	}
+	ks.delete(key)
+	ks.data[key] = &entry{value: value}
+}
+
+// LoadAndDelete deletes key, returning its value if it existed.
+func (ks *keyspace) LoadAndDelete(key string) (any, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	e, ok := ks.lookup(key)
+	ks.delete(key)
+	if !ok {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// ExpireAt returns the expiration time of key (unix time in milliseconds,
+// 0 when it never expires), and whether the key exists.
+func (ks *keyspace) ExpireAt(key string) (int64, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	e, ok := ks.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	return e.expireAt, true
+}
+
+// Expire sets the expiration time of key to expireAt (unix time in
+// milliseconds) if allowed approves of its current one (0 when it has none).
+// A time that already passed deletes the key. It returns whether the key
+// exists and was updated.
+func (ks *keyspace) Expire(key string, expireAt int64, allowed func(current int64) bool) bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	e, ok := ks.lookup(key)
+	if !ok || !allowed(e.expireAt) {
+		return false
+	}
+	if expireAt <= now() {
+		ks.delete(key)
+		return true
+	}
+	e.expireAt = expireAt
+	ks.expires[key] = struct{}{}
+	return true
+}
+
+// Persist removes the expiration time of key, returning whether it had one.
+func (ks *keyspace) Persist(key string) bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	e, ok := ks.lookup(key)
+	if !ok || e.expireAt == 0 {
+		return false
+	}
+	e.expireAt = 0
+	delete(ks.expires, key)
+	return true
+}
+
+// Flush removes every key.
+func (ks *keyspace) Flush() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.data = map[string]*entry{}
+	ks.expires = map[string]struct{}{}
+}
+
+// activeExpireCycle samples keys with an expiration time and deletes the
+// expired ones, repeating while a large share of the sample was expired.
+// It returns the number of deleted keys.
+// https://github.com/redis/redis/blob/7.2/src/expire.c
+func (ks *keyspace) activeExpireCycle() int {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	deadline := time.Now().Add(activeExpireBudget)
+	deleted := 0
+	for {
+		sampled, expired := 0, 0
+		timestamp := now()
+		// map iteration starts at a random position, which makes for a
+		// cheap random sample
+		for key := range ks.expires {
+			if sampled == activeExpireSamples {
+				break
+			}
+			sampled++
+			if ks.data[key].expired(timestamp) {
+				ks.delete(key)
+				expired++
+			}
+		}
+		deleted += expired
+
+		if sampled == 0 || float64(expired) <= activeExpireThreshold*float64(sampled) || time.Now().After(deadline) {
+			return deleted
+		}
+	}
+}
+
+// ActiveExpireCycle runs a single active expire cycle, returning the number
+// of expired keys it deleted.
+func ActiveExpireCycle() int {
+	executionLock.Lock()
+	defer executionLock.Unlock()
+	return db.activeExpireCycle()
+}
+
+// RunActiveExpire periodically deletes expired keys and hash fields that are
+// never accessed again, it never returns.
+func RunActiveExpire() {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// a key must not expire halfway through a command
+		executionLock.Lock()
+		db.activeExpireCycle()
+		activeExpireFields()
+		executionLock.Unlock()
+	}
+}
@@ -0,0 +1,146 @@
+package utils
+
+// minDequeCap is the smallest capacity a deque shrinks to.
+const minDequeCap = 8
+
+// deque is the value of list keys: a double ended queue backed by a ring
+// buffer, with O(1) pushes and pops at both ends and O(1) indexing.
+// https://redis.io/docs/data-types/lists/
+type deque struct {
+	// capacity is always a power of two, so offsets wrap with a mask
+	buf  []string
+	head int
+	size int
+}
+
+func newDeque() *deque {
+	return &deque{buf: make([]string, minDequeCap)}
+}
+
+// Len returns the number of elements, a nil deque being empty.
+func (l *deque) Len() int {
+	if l == nil {
+		return 0
+	}
+	return l.size
+}
+
+// offset returns the position in buf of the i-th element.
+func (l *deque) offset(i int) int {
+	return (l.head + i) & (len(l.buf) - 1)
+}
+
+// resize moves the elements to a buffer of capacity elements, starting at
+// its first position.
+func (l *deque) resize(capacity int) {
+	buf := make([]string, capacity)
+	if l.head+l.size <= len(l.buf) {
+		copy(buf, l.buf[l.head:l.head+l.size])
+	} else {
+		n := copy(buf, l.buf[l.head:])
+		copy(buf[n:], l.buf[:l.size-n])
+	}
+	l.buf = buf
+	l.head = 0
+}
+
+func (l *deque) grow() {
+	if l.size == len(l.buf) {
+		l.resize(2 * len(l.buf))
+	}
+}
+
+// shrink releases memory once the deque is mostly empty.
+func (l *deque) shrink() {
+	if len(l.buf) > minDequeCap && l.size <= len(l.buf)/4 {
+		l.resize(len(l.buf) / 2)
+	}
+}
+
+func (l *deque) PushFront(value string) {
+	l.grow()
+	l.head = (l.head - 1) & (len(l.buf) - 1)
+	l.buf[l.head] = value
+	l.size++
+}
+
+func (l *deque) PushBack(value string) {
+	l.grow()
+	l.buf[l.offset(l.size)] = value
+	l.size++
+}
+
+// PopFront removes and returns the first element, the deque must not be empty.
+func (l *deque) PopFront() string {
+	value := l.buf[l.head]
+	// the slot must not keep the string alive
+	l.buf[l.head] = ""
+	l.head = l.offset(1)
+	l.size--
+	l.shrink()
+	return value
+}
+
+// PopBack removes and returns the last element, the deque must not be empty.
+func (l *deque) PopBack() string {
+	i := l.offset(l.size - 1)
+	value := l.buf[i]
+	l.buf[i] = ""
+	l.size--
+	l.shrink()
+	return value
+}
+
+// At returns the i-th element, 0 <= i < Len().
+func (l *deque) At(i int) string {
+	return l.buf[l.offset(i)]
+}
+
+// Set replaces the i-th element, 0 <= i < Len().
+func (l *deque) Set(i int, value string) {
+	l.buf[l.offset(i)] = value
+}
+
+// Range returns a copy of the elements in [from, to).
+func (l *deque) Range(from int, to int) []string {
+	elements := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		elements = append(elements, l.buf[l.offset(i)])
+	}
+	return elements
+}
+
+// Insert inserts value before the i-th element, 0 <= i <= Len(), shifting
+// the shorter side of the deque.
+func (l *deque) Insert(i int, value string) {
+	if i < l.size/2 {
+		l.PushFront(value)
+		for j := 0; j < i; j++ {
+			l.Set(j, l.At(j+1))
+		}
+	} else {
+		l.PushBack(value)
+		for j := l.size - 1; j > i; j-- {
+			l.Set(j, l.At(j-1))
+		}
+	}
+	l.Set(i, value)
+}
+
+// Filter keeps the elements keep returns true for, in order.
+func (l *deque) Filter(keep func(i int, value string) bool) {
+	n := 0
+	for i := 0; i < l.size; i++ {
+		if value := l.At(i); keep(i, value) {
+			l.Set(n, value)
+			n++
+		}
+	}
+	for i := n; i < l.size; i++ {
+		l.Set(i, "")
+	}
+	l.size = n
+	for l.size <= len(l.buf)/4 && len(l.buf) > minDequeCap {
+		l.shrink()
+	}
+}
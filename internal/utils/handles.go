@@ -1,313 +1,727 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
-	"slices"
+	"math"
+	"math/big"
 	"strconv"
-	"sync"
-	"time"
+	"strings"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
 )
 
 // goroutine (concurrency) safe key-value store
-var db = sync.Map{}
+var db = newKeyspace()
+
+// errors shared by several commands
+var (
+	errWrongType  = &r.Error{Code: "WRONGTYPE", Message: "Operation against a key holding the wrong kind of value"}
+	errNotInteger = errors.New("value is not an integer or out of range")
+	errNotFloat   = errors.New("value is not a valid float")
+	errSyntax     = errors.New("syntax error")
+)
+
+// FlushDB removes every key from the store.
+func FlushDB() {
+	executionLock.Lock()
+	defer executionLock.Unlock()
+	db.Flush()
+	volatileHashes = map[string]struct{}{}
+}
 
 // https://redis.io/commands/ping/
-func HandlePING(contents []string) (string, error) {
+func HandlePING(client *Client, w *r.Writer, contents []string) {
 	if len(contents) == 1 {
-		return "PONG", nil
+		w.WriteBulkString("PONG")
 	} else if len(contents) == 2 {
-		return contents[1], nil
+		w.WriteBulkString(contents[1])
 	} else {
-		return "", fmt.Errorf("wrong number of arguments for 'ping' command")
+		w.WriteError(fmt.Errorf("wrong number of arguments for 'ping' command"))
 	}
 }
 
-// https://redis.io/commands/echo/
-func HandleECHO(contents []string) (string, error) {
-	if len(contents) == 2 {
-		return contents[1], nil
-	} else {
-		return "", fmt.Errorf("wrong number of arguments for 'echo' command")
+// https://redis.io/commands/hello/
+func HandleHELLO(client *Client, w *r.Writer, contents []string) {
+	protocol := w.Protocol
+	if len(contents) >= 2 {
+		version, err := strconv.ParseInt(contents[1], 10, 64)
+		if err != nil {
+			w.WriteError(fmt.Errorf("Protocol version is not an integer or out of range"))
+			return
+		}
+		if version != r.RESP2 && version != r.RESP3 {
+			w.WriteError(&r.Error{Code: "NOPROTO", Message: "unsupported protocol version"})
+			return
+		}
+		protocol = int(version)
 	}
-}
 
-// https://redis.io/commands/set/
-func HandleSET(contents []string) (string, error) {
-	if len(contents) == 3 {
-		key := contents[1]
-		value := contents[2]
-		db.Store(key, value)
-		return "OK", nil
-	} else if len(contents) == 5 {
-		key := contents[1]
-		value := contents[2]
-		switch contents[3] {
-		case "EX":
-			delta, err := strconv.Atoi(contents[4])
-			if err != nil {
-				return "", fmt.Errorf("value is not an integer or out of range")
+	// nothing is changed unless every option is valid
+	name := client.Name
+	for i := 2; i < len(contents); i++ {
+		switch strings.ToUpper(contents[i]) {
+		case "AUTH":
+			if i+2 >= len(contents) {
+				w.WriteError(fmt.Errorf("Syntax error in HELLO option '%s'", contents[i]))
+				return
 			}
-			if delta <= 0 {
-				return "", fmt.Errorf("invalid expire time in 'set' command")
+			// there are no ACLs, only the passwordless default user
+			if contents[i+1] != "default" {
+				w.WriteError(&r.Error{Code: "WRONGPASS", Message: "invalid username-password pair or user is disabled."})
+				return
 			}
-
-			db.Store(key, value)
-			time.AfterFunc(time.Duration(delta)*time.Second, func() { db.Delete(key) })
-			return "OK", nil
-
-		case "PX":
-			delta, err := strconv.Atoi(contents[4])
-			if err != nil {
-				return "", fmt.Errorf("value is not an integer or out of range")
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(contents) {
+				w.WriteError(fmt.Errorf("Syntax error in HELLO option '%s'", contents[i]))
+				return
 			}
-			if delta <= 0 {
-				return "", fmt.Errorf("invalid expire time in 'set' command")
+			name = contents[i+1]
+			for _, c := range name {
+				if c <= ' ' || c > '~' {
+					w.WriteError(fmt.Errorf("Client names cannot contain spaces, newlines or special characters."))
+					return
+				}
 			}
+			i++
+		default:
+			w.WriteError(fmt.Errorf("Syntax error in HELLO option '%s'", contents[i]))
+			return
+		}
+	}
+
+	w.Protocol = protocol
+	client.Name = name
+
+	w.WriteMapHeader(7)
+	w.WriteBulkString("server")
+	w.WriteBulkString("redis")
+	w.WriteBulkString("version")
+	w.WriteBulkString(serverVersion)
+	w.WriteBulkString("proto")
+	w.WriteInteger(int64(protocol))
+	w.WriteBulkString("id")
+	w.WriteInteger(client.ID)
+	w.WriteBulkString("mode")
+	w.WriteBulkString("standalone")
+	w.WriteBulkString("role")
+	w.WriteBulkString("master")
+	w.WriteBulkString("modules")
+	w.WriteArrayHeader(0)
+}
+
+// https://redis.io/commands/echo/
+func HandleECHO(client *Client, w *r.Writer, contents []string) {
+	w.WriteBulkString(contents[1])
+}
 
-			db.Store(key, value)
-			time.AfterFunc(time.Duration(delta)*time.Millisecond, func() { db.Delete(key) })
-			return "OK", nil
+// parseExpireTime turns the argument of an EX, PX, EXAT or PXAT option into
+// an absolute unix time in milliseconds.
+func parseExpireTime(option string, arg string, command string) (int64, error) {
+	amount, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	invalid := fmt.Errorf("invalid expire time in '%s' command", command)
+	if amount <= 0 {
+		return 0, invalid
+	}
 
-		case "EXAT":
-			timestamp, err := strconv.ParseInt(contents[4], 10, 64)
-			if err != nil {
-				return "", fmt.Errorf("value is not an integer or out of range")
+	var expireAt int64
+	switch option {
+	case "EX":
+		if amount > (math.MaxInt64-now())/1000 {
+			return 0, invalid
+		}
+		expireAt = now() + amount*1000
+	case "PX":
+		if amount > math.MaxInt64-now() {
+			return 0, invalid
+		}
+		expireAt = now() + amount
+	case "EXAT":
+		if amount > math.MaxInt64/1000 {
+			return 0, invalid
+		}
+		expireAt = amount * 1000
+	case "PXAT":
+		expireAt = amount
+	}
+	return expireAt, nil
+}
+
+// https://redis.io/commands/set/
+func HandleSET(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	value := contents[2]
+
+	nx, xx, get, keepTTL := false, false, false, false
+	expireOption, expireArg := "", ""
+	for i := 3; i < len(contents); i++ {
+		option := strings.ToUpper(contents[i])
+		switch option {
+		case "NX":
+			if xx {
+				w.WriteError(errSyntax)
+				return
+			}
+			nx = true
+		case "XX":
+			if nx {
+				w.WriteError(errSyntax)
+				return
+			}
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			if expireOption != "" {
+				w.WriteError(errSyntax)
+				return
 			}
-			if timestamp <= 0 {
-				return "", fmt.Errorf("invalid expire time in 'set' command")
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if keepTTL || expireOption != "" || i+1 == len(contents) {
+				w.WriteError(errSyntax)
+				return
 			}
+			expireOption, expireArg = option, contents[i+1]
+			i++
+		default:
+			w.WriteError(errSyntax)
+			return
+		}
+	}
 
-			db.Store(key, value)
+	var expireAt int64
+	if expireOption != "" {
+		var err error
+		expireAt, err = parseExpireTime(expireOption, expireArg, "set")
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+	}
 
-			delta := timestamp - time.Now().Unix()
-			if delta <= 0 {
-				return "", fmt.Errorf("invalid expire time in 'set' command")
-			}
+	old, exists := db.Load(key)
+	if get && exists {
+		if _, ok := old.(string); !ok {
+			w.WriteError(errWrongType)
+			return
+		}
+	}
 
-			time.AfterFunc(time.Duration(delta)*time.Second, func() { db.Delete(key) })
-			return "OK", nil
+	if (nx && exists) || (xx && !exists) {
+		if get && exists {
+			w.WriteBulkString(old.(string))
+		} else {
+			w.WriteNull()
+		}
+		return
+	}
 
-		case "PXAT":
-			timestamp, err := strconv.ParseInt(contents[4], 10, 64)
-			if err != nil {
-				return "", fmt.Errorf("value is not an integer or out of range")
-			}
-			if timestamp <= 0 {
-				return "", fmt.Errorf("invalid expire time in 'set' command")
-			}
+	if keepTTL {
+		db.StoreKeepTTL(key, value)
+	} else {
+		db.StoreWithExpiry(key, value, expireAt)
+	}
 
-			db.Store(key, value)
+	if !get {
+		w.WriteOK()
+	} else if exists {
+		w.WriteBulkString(old.(string))
+	} else {
+		w.WriteNull()
+	}
+}
 
-			delta := timestamp - time.Now().UnixMilli()
-			if delta <= 0 {
-				return "", fmt.Errorf("invalid expire time in 'set' command")
-			}
+// https://redis.io/commands/setnx/
+func HandleSETNX(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	if _, exists := db.Load(key); exists {
+		w.WriteInteger(0)
+		return
+	}
+	db.Store(key, contents[2])
+	w.WriteInteger(1)
+}
 
-			time.AfterFunc(time.Duration(delta)*time.Millisecond, func() { db.Delete(key) })
-			return "OK", nil
+// https://redis.io/commands/setex/
+func HandleSETEX(client *Client, w *r.Writer, contents []string) {
+	expireAt, err := parseExpireTime("EX", contents[2], "setex")
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	db.StoreWithExpiry(contents[1], contents[3], expireAt)
+	w.WriteOK()
+}
 
-		default:
-			return "", fmt.Errorf("syntax error")
+// https://redis.io/commands/psetex/
+func HandlePSETEX(client *Client, w *r.Writer, contents []string) {
+	expireAt, err := parseExpireTime("PX", contents[2], "psetex")
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	db.StoreWithExpiry(contents[1], contents[3], expireAt)
+	w.WriteOK()
+}
+
+// https://redis.io/commands/getset/
+func HandleGETSET(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	old, exists := db.Load(key)
+	if exists {
+		if _, ok := old.(string); !ok {
+			w.WriteError(errWrongType)
+			return
 		}
 	}
-	return "", fmt.Errorf("wrong number of arguments for 'set' command")
+
+	db.Store(key, contents[2])
+	if exists {
+		w.WriteBulkString(old.(string))
+	} else {
+		w.WriteNull()
+	}
 }
 
 // https://redis.io/commands/get/
-func HandleGET(contents []string) (string, error) {
-	if len(contents) == 2 {
-		key := contents[1]
+func HandleGET(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	value, ok := db.Load(key)
+	if !ok {
+		w.WriteNull()
+		return
+	}
+	stringValue, ok := value.(string)
+	if !ok {
+		w.WriteError(errWrongType)
+		return
+	}
+	w.WriteBulkString(stringValue)
+}
+
+// https://redis.io/commands/mget/
+func HandleMGET(client *Client, w *r.Writer, contents []string) {
+	keys := contents[1:]
+	w.WriteArrayHeader(len(keys))
+	for _, key := range keys {
 		value, ok := db.Load(key)
 		if !ok {
-			return "", fmt.Errorf("NULL")
+			w.WriteNull()
+			continue
 		}
-		return value.(string), nil
+		// values of other types are reported as missing, not as errors
+		stringValue, ok := value.(string)
+		if !ok {
+			w.WriteNull()
+			continue
+		}
+		w.WriteBulkString(stringValue)
 	}
-	return "", fmt.Errorf("wrong number of arguments for 'get' command")
+}
+
+// https://redis.io/commands/mset/
+func HandleMSET(client *Client, w *r.Writer, contents []string) {
+	if len(contents)%2 != 1 {
+		w.WriteError(fmt.Errorf("wrong number of arguments for 'mset' command"))
+		return
+	}
+	for i := 1; i < len(contents); i += 2 {
+		db.Store(contents[i], contents[i+1])
+	}
+	w.WriteOK()
+}
+
+// https://redis.io/commands/msetnx/
+func HandleMSETNX(client *Client, w *r.Writer, contents []string) {
+	if len(contents)%2 != 1 {
+		w.WriteError(fmt.Errorf("wrong number of arguments for 'msetnx' command"))
+		return
+	}
+	// nothing is set if any of the keys exists
+	for i := 1; i < len(contents); i += 2 {
+		if _, exists := db.Load(contents[i]); exists {
+			w.WriteInteger(0)
+			return
+		}
+	}
+	for i := 1; i < len(contents); i += 2 {
+		db.Store(contents[i], contents[i+1])
+	}
+	w.WriteInteger(1)
 }
 
 // https://redis.io/commands/exists/
-func HandleEXISTS(contents []string) (int, error) {
-	if len(contents) >= 2 {
-		count := 0
-		keys := contents[1:]
-		for _, key := range keys {
-			_, ok := db.Load(key)
-			if ok {
-				count++
-			}
+func HandleEXISTS(client *Client, w *r.Writer, contents []string) {
+	count := 0
+	keys := contents[1:]
+	for _, key := range keys {
+		_, ok := db.Load(key)
+		if ok {
+			count++
 		}
-		return count, nil
 	}
-	return -1, fmt.Errorf("wrong number of arguments for 'EXISTS' command")
+	w.WriteInteger(int64(count))
 }
 
 // https://redis.io/commands/del/
-func HandleDEL(contents []string) (int, error) {
-	if len(contents) >= 2 {
-		count := 0
-		keys := contents[1:]
-		for _, key := range keys {
-			_, loaded := db.LoadAndDelete(key)
-			if loaded {
-				count++
-			}
+func HandleDEL(client *Client, w *r.Writer, contents []string) {
+	count := 0
+	keys := contents[1:]
+	for _, key := range keys {
+		_, loaded := db.LoadAndDelete(key)
+		if loaded {
+			count++
 		}
-		return count, nil
 	}
-	return -1, fmt.Errorf("wrong number of arguments for 'DEL' command")
+	w.WriteInteger(int64(count))
 }
 
-// https://redis.io/commands/incr/
-func HandleINCR(contents []string) (int, error) {
-	if len(contents) == 2 {
-		key := contents[1]
-		value, ok := db.Load(key)
+// parseInteger parses a 64 bit signed integer as strictly as redis does:
+// no sign other than '-', no leading zeros and no spaces.
+func parseInteger(value string) (int64, error) {
+	if len(value) == 0 || len(value) > 20 || value[0] == '+' ||
+		(len(value) > 1 && value[0] == '0') || strings.HasPrefix(value, "-0") {
+		return 0, errNotInteger
+	}
+	intValue, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return intValue, nil
+}
+
+// shared by INCR, DECR, INCRBY and DECRBY
+func incrDecr(w *r.Writer, key string, delta int64) {
+	var intValue int64
+	value, ok := db.Load(key)
+	if ok {
+		stringValue, ok := value.(string)
 		if !ok {
-			value = "0"
+			w.WriteError(errWrongType)
+			return
 		}
-		intValue, err := strconv.ParseInt(value.(string), 10, 64)
+		var err error
+		intValue, err = parseInteger(stringValue)
 		if err != nil {
-			return -1, fmt.Errorf("value is not an integer or out of range")
+			w.WriteError(err)
+			return
 		}
-		intValue++
-		db.Store(key, fmt.Sprint(intValue))
-		return int(intValue), nil
 	}
-	return -1, fmt.Errorf("wrong number of arguments for 'INCR' command")
+
+	if (delta < 0 && intValue < math.MinInt64-delta) || (delta > 0 && intValue > math.MaxInt64-delta) {
+		w.WriteError(fmt.Errorf("increment or decrement would overflow"))
+		return
+	}
+	intValue += delta
+	db.StoreKeepTTL(key, strconv.FormatInt(intValue, 10))
+	w.WriteInteger(intValue)
+}
+
+// https://redis.io/commands/incr/
+func HandleINCR(client *Client, w *r.Writer, contents []string) {
+	incrDecr(w, contents[1], 1)
 }
 
 // https://redis.io/commands/decr/
-func HandleDECR(contents []string) (int, error) {
-	if len(contents) == 2 {
-		key := contents[1]
-		value, ok := db.Load(key)
-		if !ok {
-			value = "0"
-		}
-		intValue, err := strconv.ParseInt(value.(string), 10, 64)
-		if err != nil {
-			return -1, fmt.Errorf("value is not an integer or out of range")
-		}
-		intValue--
-		db.Store(key, fmt.Sprint(intValue))
-		return int(intValue), nil
+func HandleDECR(client *Client, w *r.Writer, contents []string) {
+	incrDecr(w, contents[1], -1)
+}
+
+// https://redis.io/commands/incrby/
+func HandleINCRBY(client *Client, w *r.Writer, contents []string) {
+	increment, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
 	}
-	return -1, fmt.Errorf("wrong number of arguments for 'DECR' command")
+	incrDecr(w, contents[1], increment)
 }
 
-// https://redis.io/commands/lpush/
-func HandleLPUSH(contents []string) (int, error) {
-	if len(contents) >= 3 {
-		key := contents[1]
-		elements := contents[2:]
-		slices.Reverse(elements)
+// https://redis.io/commands/decrby/
+func HandleDECRBY(client *Client, w *r.Writer, contents []string) {
+	decrement, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	// -math.MinInt64 doesn't fit in an int64
+	if decrement == math.MinInt64 {
+		w.WriteError(fmt.Errorf("decrement would overflow"))
+		return
+	}
+	incrDecr(w, contents[1], -decrement)
+}
 
-		var listValue []string
+// redis does float arithmetic with long doubles, which have a 64 bit mantissa
+// and overflow at 2^16384
+const (
+	longDoublePrecision = 64
+	longDoubleMaxExp    = 16384
+)
 
-		value, ok := db.Load(key)
-		if !ok {
-			listValue = make([]string, 0)
-		} else {
-			var ok bool
-			listValue, ok = value.([]string)
-			if !ok {
-				return -1, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
-			}
-		}
+// exceedsLongDouble returns whether value is too large for a long double,
+// which big.Float never overflows at.
+func exceedsLongDouble(value *big.Float) bool {
+	return value.IsInf() || value.MantExp(nil) > longDoubleMaxExp
+}
 
-		listValue = append(elements, listValue...)
-		db.Store(key, listValue)
-		return len(listValue), nil
+// parseFloat parses a float the way INCRBYFLOAT accepts them. Values out of
+// the range of long doubles are infinite.
+func parseFloat(value string) (*big.Float, error) {
+	floatValue, _, err := big.ParseFloat(value, 10, longDoublePrecision, big.ToNearestEven)
+	if err != nil {
+		return nil, errNotFloat
+	}
+	if exceedsLongDouble(floatValue) {
+		floatValue.SetInf(floatValue.Signbit())
 	}
-	return -1, fmt.Errorf("wrong number of arguments for 'LPUSH' command")
+	return floatValue, nil
 }
 
-// https://redis.io/commands/rpush/
-func HandleRPUSH(contents []string) (int, error) {
-	if len(contents) >= 3 {
-		key := contents[1]
-		elements := contents[2:]
+// formatFloat prints value like redis' "%.17Lf" without trailing zeros,
+// never in exponential notation so the result can be parsed back.
+func formatFloat(value *big.Float) string {
+	result := value.Text('f', 17)
+	result = strings.TrimRight(result, "0")
+	result = strings.TrimSuffix(result, ".")
+	if result == "-0" {
+		return "0"
+	}
+	return result
+}
 
-		var listValue []string
+// https://redis.io/commands/incrbyfloat/
+func HandleINCRBYFLOAT(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	increment, err := parseFloat(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
 
-		value, ok := db.Load(key)
+	floatValue := new(big.Float).SetPrec(longDoublePrecision)
+	value, ok := db.Load(key)
+	if ok {
+		stringValue, ok := value.(string)
 		if !ok {
-			listValue = make([]string, 0)
-		} else {
-			var ok bool
-			listValue, ok = value.([]string)
-			if !ok {
-				return -1, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
-			}
+			w.WriteError(errWrongType)
+			return
 		}
+		floatValue, err = parseFloat(stringValue)
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+	}
 
-		listValue = append(listValue, elements...)
-		db.Store(key, listValue)
-		return len(listValue), nil
+	// anything added to or from infinity is either infinite or NaN
+	if floatValue.IsInf() || increment.IsInf() {
+		w.WriteError(fmt.Errorf("increment would produce NaN or Infinity"))
+		return
 	}
-	return -1, fmt.Errorf("wrong number of arguments for 'RPUSH' command")
+
+	if exceedsLongDouble(floatValue.Add(floatValue, increment)) {
+		w.WriteError(fmt.Errorf("increment would produce NaN or Infinity"))
+		return
+	}
+	result := formatFloat(floatValue)
+	db.StoreKeepTTL(key, result)
+	w.WriteBulkString(result)
+}
+
+// https://redis.io/commands/lpush/
+func HandleLPUSH(client *Client, w *r.Writer, contents []string) {
+	pushGeneric(w, contents, true)
+}
+
+// https://redis.io/commands/rpush/
+func HandleRPUSH(client *Client, w *r.Writer, contents []string) {
+	pushGeneric(w, contents, false)
 }
 
 // https://redis.io/commands/lrange/
-func HandleLRANGE(contents []string) ([]string, error) {
-	if len(contents) == 4 {
-		key := contents[1]
+func HandleLRANGE(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
 
-		var list []string
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteStringArray([]string{})
+		return
+	}
 
-		value, ok := db.Load(key)
-		if !ok {
-			return make([]string, 0), nil
-		} else {
-			var ok bool
-			list, ok = value.([]string)
-			if !ok {
-				return []string{}, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
-			}
-		}
+	start, err := strconv.ParseInt(contents[2], 10, 64)
+	if err != nil {
+		w.WriteError(errNotInteger)
+		return
+	}
 
-		start, err := strconv.ParseInt(contents[2], 10, 64)
-		if err != nil {
-			return []string{}, fmt.Errorf("value is not an integer or out of range")
-		}
+	stop, err := strconv.ParseInt(contents[3], 10, 64)
+	if err != nil {
+		w.WriteError(errNotInteger)
+		return
+	}
 
-		stop, err := strconv.ParseInt(contents[3], 10, 64)
-		if err != nil {
-			return []string{}, fmt.Errorf("value is not an integer or out of range")
+	from, to, ok := clampRange(start, stop, list.Len())
+	if !ok {
+		w.WriteStringArray([]string{})
+		return
+	}
+	w.WriteArrayHeader(to - from)
+	for i := from; i < to; i++ {
+		w.WriteBulkString(list.At(i))
+	}
+}
+
+// expireCondition returns whether the NX, XX, GT and LT options allow
+// replacing an expiration time (0 when there's none) with expireAt.
+func expireCondition(nx, xx, gt, lt bool, expireAt int64) func(current int64) bool {
+	return func(current int64) bool {
+		// a key without an expiration time lives forever
+		if nx && current != 0 {
+			return false
+		}
+		if xx && current == 0 {
+			return false
+		}
+		if gt && (current == 0 || expireAt <= current) {
+			return false
 		}
+		if lt && current != 0 && expireAt >= current {
+			return false
+		}
+		return true
+	}
+}
 
-		fmt.Println(start, stop, list)
+// shared by EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT: the expiration time in
+// milliseconds is base + contents[2]*unit
+func expireGeneric(w *r.Writer, contents []string, base int64, unit int64) {
+	key := contents[1]
+	amount, err := strconv.ParseInt(contents[2], 10, 64)
+	if err != nil {
+		w.WriteError(errNotInteger)
+		return
+	}
 
-		if int(start) >= len(list) {
-			return make([]string, 0), nil
-		} else if start == 0 && stop == -1 {
-			return list, nil
+	nx, xx, gt, lt := false, false, false, false
+	for _, option := range contents[3:] {
+		switch strings.ToUpper(option) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			w.WriteError(fmt.Errorf("Unsupported option %s", option))
+			return
 		}
+	}
+	if nx && (xx || gt || lt) {
+		w.WriteError(fmt.Errorf("NX and XX, GT or LT options at the same time are not compatible"))
+		return
+	}
+	if gt && lt {
+		w.WriteError(fmt.Errorf("GT and LT options at the same time are not compatible"))
+		return
+	}
 
-		if start < 0 {
-			start = int64(len(list) + int(start))
-			if start < 0 {
-				start = 0
-			}
-		}
+	expireAt := amount * unit
+	if expireAt/unit != amount || (amount > 0 && base > math.MaxInt64-expireAt) {
+		w.WriteError(fmt.Errorf("invalid expire time in '%s' command", strings.ToLower(contents[0])))
+		return
+	}
+	expireAt += base
 
-		if stop < 0 {
-			stop = int64(len(list) + int(stop) + 1)
-			if stop < 0 {
-				stop = int64(len(list))
-			}
-		} else if int(stop) > len(list) {
-			stop = int64(len(list))
+	if db.Expire(key, expireAt, expireCondition(nx, xx, gt, lt, expireAt)) {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+}
+
+// https://redis.io/commands/expire/
+func HandleEXPIRE(client *Client, w *r.Writer, contents []string) {
+	expireGeneric(w, contents, now(), 1000)
+}
+
+// https://redis.io/commands/pexpire/
+func HandlePEXPIRE(client *Client, w *r.Writer, contents []string) {
+	expireGeneric(w, contents, now(), 1)
+}
+
+// https://redis.io/commands/expireat/
+func HandleEXPIREAT(client *Client, w *r.Writer, contents []string) {
+	expireGeneric(w, contents, 0, 1000)
+}
+
+// https://redis.io/commands/pexpireat/
+func HandlePEXPIREAT(client *Client, w *r.Writer, contents []string) {
+	expireGeneric(w, contents, 0, 1)
+}
+
+// shared by TTL, PTTL, EXPIRETIME and PEXPIRETIME, replies with -2 when the
+// key doesn't exist and -1 when it has no expiration time
+func ttlGeneric(w *r.Writer, key string, milliseconds bool, absolute bool) {
+	expireAt, ok := db.ExpireAt(key)
+	if !ok {
+		w.WriteInteger(-2)
+		return
+	} else if expireAt == 0 {
+		w.WriteInteger(-1)
+		return
+	}
+
+	value := expireAt
+	if !absolute {
+		value = max(expireAt-now(), 0)
+	}
+	if !milliseconds {
+		if absolute {
+			value /= 1000
 		} else {
-			stop++
+			value = (value + 500) / 1000
 		}
+	}
+	w.WriteInteger(value)
+}
 
-		if start > stop {
-			return make([]string, 0), nil
-		}
+// https://redis.io/commands/ttl/
+func HandleTTL(client *Client, w *r.Writer, contents []string) {
+	ttlGeneric(w, contents[1], false, false)
+}
+
+// https://redis.io/commands/pttl/
+func HandlePTTL(client *Client, w *r.Writer, contents []string) {
+	ttlGeneric(w, contents[1], true, false)
+}
 
-		return list[start:stop], nil
+// https://redis.io/commands/expiretime/
+func HandleEXPIRETIME(client *Client, w *r.Writer, contents []string) {
+	ttlGeneric(w, contents[1], false, true)
+}
+
+// https://redis.io/commands/pexpiretime/
+func HandlePEXPIRETIME(client *Client, w *r.Writer, contents []string) {
+	ttlGeneric(w, contents[1], true, true)
+}
+
+// https://redis.io/commands/persist/
+func HandlePERSIST(client *Client, w *r.Writer, contents []string) {
+	if db.Persist(contents[1]) {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
 	}
-	return []string{}, fmt.Errorf("wrong number of arguments for 'LRANGE' command")
 }
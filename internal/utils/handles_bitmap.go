@@ -0,0 +1,540 @@
+package utils
+
+import (
+	"errors"
+	"math/bits"
+	"strings"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+// Bitmaps are plain strings, bit 0 being the most significant bit of the
+// first byte.
+// https://redis.io/docs/data-types/bitmaps/
+
+var (
+	errBitOffset = errors.New("bit offset is not an integer or out of range")
+	errBitValue  = errors.New("bit is not an integer or out of range")
+)
+
+// parseBitOffset parses the bit offset of SETBIT and GETBIT, which can't
+// address past the maximum string size.
+func parseBitOffset(arg string) (int64, error) {
+	offset, err := parseInteger(arg)
+	if err != nil || offset < 0 || offset >= maxStringLen*8 {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+// parseBit parses a bit value, which must be 0 or 1.
+func parseBit(arg string, invalid error) (byte, error) {
+	switch arg {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	}
+	return 0, invalid
+}
+
+func bitAt(value string, offset int) byte {
+	return (value[offset>>3] >> (7 - offset&7)) & 1
+}
+
+// parseBitRange parses the optional start, end and BYTE|BIT unit of BITCOUNT
+// and BITPOS into a range of bits [from, to) of value. endGiven is whether
+// args had an end.
+func parseBitRange(value string, args []string) (from int, to int, endGiven bool, err error) {
+	start, end := int64(0), int64(-1)
+	if len(args) > 0 {
+		if start, err = parseInteger(args[0]); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	if len(args) > 1 {
+		if end, err = parseInteger(args[1]); err != nil {
+			return 0, 0, false, err
+		}
+		endGiven = true
+	}
+
+	unit := 8
+	if len(args) > 2 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			unit = 1
+		default:
+			return 0, 0, false, errSyntax
+		}
+	}
+	if len(args) > 3 {
+		return 0, 0, false, errSyntax
+	}
+
+	from, to, ok := clampRange(start, end, len(value)*8/unit)
+	if !ok {
+		return 0, 0, endGiven, nil
+	}
+	return from * unit, to * unit, endGiven, nil
+}
+
+// https://redis.io/commands/setbit/
+func HandleSETBIT(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	offset, err := parseBitOffset(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	bit, err := parseBit(contents[3], errBitValue)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	value, _, err := loadString(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	buffer := []byte(value)
+	// the string grows, zero padded, to hold the bit
+	if index := int(offset >> 3); index >= len(buffer) {
+		buffer = append(buffer, make([]byte, index+1-len(buffer))...)
+	}
+	mask := byte(1) << (7 - offset&7)
+	previous := 0
+	if buffer[offset>>3]&mask != 0 {
+		previous = 1
+	}
+	if bit == 1 {
+		buffer[offset>>3] |= mask
+	} else {
+		buffer[offset>>3] &^= mask
+	}
+
+	db.StoreKeepTTL(key, string(buffer))
+	w.WriteInteger(int64(previous))
+}
+
+// https://redis.io/commands/getbit/
+func HandleGETBIT(client *Client, w *r.Writer, contents []string) {
+	offset, err := parseBitOffset(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	value, _, err := loadString(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	if offset >= int64(len(value))*8 {
+		w.WriteInteger(0)
+		return
+	}
+	w.WriteInteger(int64(bitAt(value, int(offset))))
+}
+
+// https://redis.io/commands/bitcount/
+func HandleBITCOUNT(client *Client, w *r.Writer, contents []string) {
+	// a start requires an end
+	if len(contents) == 3 {
+		w.WriteError(errSyntax)
+		return
+	}
+	value, _, err := loadString(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	from, to, _, err := parseBitRange(value, contents[2:])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	count := 0
+	for i := from; i < to; {
+		// whole bytes are counted at once
+		if i&7 == 0 && i+8 <= to {
+			count += bits.OnesCount8(value[i>>3])
+			i += 8
+			continue
+		}
+		count += int(bitAt(value, i))
+		i++
+	}
+	w.WriteInteger(int64(count))
+}
+
+// https://redis.io/commands/bitpos/
+func HandleBITPOS(client *Client, w *r.Writer, contents []string) {
+	bit, err := parseBit(contents[2], errors.New("The bit argument must be 1 or 0."))
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	value, exists, err := loadString(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	from, to, endGiven, err := parseBitRange(value, contents[3:])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	// a missing key is an empty string, which is all clear bits
+	if !exists {
+		if bit == 1 {
+			w.WriteInteger(-1)
+		} else {
+			w.WriteInteger(0)
+		}
+		return
+	}
+	if from == to {
+		w.WriteInteger(-1)
+		return
+	}
+
+	// bytes holding none of the bit being looked for are skipped at once
+	skip := byte(0x00)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := from; i < to; {
+		if i&7 == 0 && i+8 <= to && value[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if bitAt(value, i) == bit {
+			w.WriteInteger(int64(i))
+			return
+		}
+		i++
+	}
+
+	// looking for a clear bit without an end, the string is considered
+	// padded with zeros on the right
+	if bit == 0 && !endGiven {
+		w.WriteInteger(int64(to))
+		return
+	}
+	w.WriteInteger(-1)
+}
+
+// https://redis.io/commands/bitop/
+func HandleBITOP(client *Client, w *r.Writer, contents []string) {
+	op := strings.ToUpper(contents[1])
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(contents) != 4 {
+			w.WriteError(errors.New("BITOP NOT must be called with a single source key."))
+			return
+		}
+	default:
+		w.WriteError(errSyntax)
+		return
+	}
+
+	destination := contents[2]
+	sources := make([]string, 0, len(contents)-3)
+	length := 0
+	for _, key := range contents[3:] {
+		value, _, err := loadString(key)
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		sources = append(sources, value)
+		length = max(length, len(value))
+	}
+
+	// shorter strings are considered padded with zero bytes
+	byteAt := func(value string, i int) byte {
+		if i < len(value) {
+			return value[i]
+		}
+		return 0
+	}
+	result := make([]byte, length)
+	for i := range result {
+		b := byteAt(sources[0], i)
+		switch op {
+		case "NOT":
+			b = ^b
+		case "AND":
+			for _, source := range sources[1:] {
+				b &= byteAt(source, i)
+			}
+		case "OR":
+			for _, source := range sources[1:] {
+				b |= byteAt(source, i)
+			}
+		case "XOR":
+			for _, source := range sources[1:] {
+				b ^= byteAt(source, i)
+			}
+		}
+		result[i] = b
+	}
+
+	if length == 0 {
+		db.LoadAndDelete(destination)
+	} else {
+		db.Store(destination, string(result))
+	}
+	w.WriteInteger(int64(length))
+}
+
+// bitfieldOp is a single GET, SET or INCRBY of a BITFIELD command.
+type bitfieldOp struct {
+	// GET, SET or INCRBY
+	kind   string
+	signed bool
+	bits   int
+	offset int64
+	// the value of SET, the increment of INCRBY
+	value int64
+	// WRAP, SAT or FAIL
+	overflow string
+}
+
+// parseBitfieldType parses an encoding like i16 or u8. Unsigned integers are
+// at most 63 bits wide, so that every value fits an int64 reply.
+func parseBitfieldType(arg string) (signed bool, width int, err error) {
+	invalid := errors.New("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(arg) < 2 || (arg[0] != 'i' && arg[0] != 'I' && arg[0] != 'u' && arg[0] != 'U') {
+		return false, 0, invalid
+	}
+	signed = arg[0] == 'i' || arg[0] == 'I'
+	bits, err := parseInteger(arg[1:])
+	if err != nil || bits < 1 || (signed && bits > 64) || (!signed && bits > 63) {
+		return false, 0, invalid
+	}
+	return signed, int(bits), nil
+}
+
+// parseBitfieldOffset parses a bit offset, or with a # prefix an offset in
+// multiples of width.
+func parseBitfieldOffset(arg string, width int) (int64, error) {
+	multiply := strings.HasPrefix(arg, "#")
+	if multiply {
+		arg = arg[1:]
+	}
+	offset, err := parseInteger(arg)
+	if err != nil || offset < 0 {
+		return 0, errBitOffset
+	}
+	if multiply {
+		if offset > (maxStringLen*8)/int64(width) {
+			return 0, errBitOffset
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width) > maxStringLen*8 {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+// getBitfield reads width bits at offset of buffer, bits past its end are 0.
+func getBitfield(buffer []byte, offset int64, width int) uint64 {
+	var value uint64
+	for i := int64(0); i < int64(width); i++ {
+		value <<= 1
+		if index := (offset + i) >> 3; index < int64(len(buffer)) {
+			value |= uint64(buffer[index]>>(7-(offset+i)&7)) & 1
+		}
+	}
+	return value
+}
+
+// setBitfield writes the low width bits of value at offset of buffer, which
+// must be large enough.
+func setBitfield(buffer []byte, offset int64, width int, value uint64) {
+	for i := int64(0); i < int64(width); i++ {
+		mask := byte(1) << (7 - (offset+i)&7)
+		if value>>(int64(width)-1-i)&1 == 1 {
+			buffer[(offset+i)>>3] |= mask
+		} else {
+			buffer[(offset+i)>>3] &^= mask
+		}
+	}
+}
+
+// bitfieldAdd adds increment to value, an integer of width bits, handling
+// overflows the way op asks for. ok is false when the addition overflowed
+// and the FAIL behavior applies.
+// https://github.com/redis/redis/blob/7.2/src/bitops.c
+func bitfieldAdd(op *bitfieldOp, value int64, increment int64) (result int64, ok bool) {
+	var maximum, minimum int64
+	if op.signed {
+		maximum = int64(uint64(1)<<(op.bits-1) - 1)
+		minimum = -maximum - 1
+	} else {
+		maximum = int64(uint64(1)<<op.bits - 1)
+		minimum = 0
+	}
+
+	// value is within bounds, so below 64 bits neither difference overflows
+	overflowUp := increment > maximum-value
+	overflowDown := increment < minimum-value
+	if op.bits == 64 {
+		// the differences are only taken on the side of zero where they can't
+		// wrap: a negative value can't overflow up, nor a positive one down
+		overflowUp = value >= 0 && increment > maximum-value
+		overflowDown = value < 0 && increment < minimum-value
+	}
+	if !overflowUp && !overflowDown {
+		return value + increment, true
+	}
+
+	switch op.overflow {
+	case "SAT":
+		if overflowUp {
+			return maximum, true
+		}
+		return minimum, true
+	case "FAIL":
+		return 0, false
+	}
+
+	// WRAP keeps the low bits of the sum, sign extending them
+	sum := uint64(value) + uint64(increment)
+	if op.bits == 64 {
+		return int64(sum), true
+	}
+	sum &= uint64(1)<<op.bits - 1
+	if op.signed && sum&(uint64(1)<<(op.bits-1)) != 0 {
+		sum |= ^uint64(0) << op.bits
+	}
+	return int64(sum), true
+}
+
+// bitfieldGeneric implements BITFIELD and its read only variant.
+func bitfieldGeneric(w *r.Writer, contents []string, readonly bool) {
+	key := contents[1]
+	var ops []bitfieldOp
+	overflow := "WRAP"
+	writes := false
+	// the string grows to this many bytes when there are writes
+	length := 0
+
+	for i := 2; i < len(contents); i++ {
+		remaining := len(contents) - i - 1
+		subcommand := strings.ToUpper(contents[i])
+		switch {
+		case subcommand == "OVERFLOW" && remaining >= 1:
+			overflow = strings.ToUpper(contents[i+1])
+			if overflow != "WRAP" && overflow != "SAT" && overflow != "FAIL" {
+				w.WriteError(errors.New("Invalid OVERFLOW type specified"))
+				return
+			}
+			i++
+			continue
+		case subcommand == "GET" && remaining >= 2:
+		case (subcommand == "SET" || subcommand == "INCRBY") && remaining >= 3:
+		default:
+			w.WriteError(errSyntax)
+			return
+		}
+
+		signed, width, err := parseBitfieldType(contents[i+1])
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		offset, err := parseBitfieldOffset(contents[i+2], width)
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		op := bitfieldOp{kind: subcommand, signed: signed, bits: width, offset: offset, overflow: overflow}
+		i += 2
+
+		if subcommand != "GET" {
+			if readonly {
+				w.WriteError(errors.New("BITFIELD_RO only supports the GET subcommand"))
+				return
+			}
+			if op.value, err = parseInteger(contents[i+1]); err != nil {
+				w.WriteError(err)
+				return
+			}
+			i++
+			writes = true
+			length = max(length, int((offset+int64(width)-1)>>3)+1)
+		}
+		ops = append(ops, op)
+	}
+
+	value, _, err := loadString(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	buffer := []byte(value)
+	if length > len(buffer) {
+		buffer = append(buffer, make([]byte, length-len(buffer))...)
+	}
+
+	// reads the field of op as an integer
+	load := func(op *bitfieldOp) int64 {
+		field := getBitfield(buffer, op.offset, op.bits)
+		if op.signed && op.bits < 64 && field&(uint64(1)<<(op.bits-1)) != 0 {
+			field |= ^uint64(0) << op.bits
+		}
+		return int64(field)
+	}
+
+	w.WriteArrayHeader(len(ops))
+	for i := range ops {
+		op := &ops[i]
+		current := load(op)
+		switch op.kind {
+		case "GET":
+			w.WriteInteger(current)
+		case "SET":
+			// the new value overflows the field the same way an increment
+			// from zero would
+			updated, ok := bitfieldAdd(op, 0, op.value)
+			if !ok {
+				w.WriteNull()
+				continue
+			}
+			setBitfield(buffer, op.offset, op.bits, uint64(updated))
+			w.WriteInteger(current)
+		case "INCRBY":
+			updated, ok := bitfieldAdd(op, current, op.value)
+			if !ok {
+				w.WriteNull()
+				continue
+			}
+			setBitfield(buffer, op.offset, op.bits, uint64(updated))
+			w.WriteInteger(updated)
+		}
+	}
+
+	if writes {
+		db.StoreKeepTTL(key, string(buffer))
+	}
+}
+
+// https://redis.io/commands/bitfield/
+func HandleBITFIELD(client *Client, w *r.Writer, contents []string) {
+	bitfieldGeneric(w, contents, false)
+}
+
+// https://redis.io/commands/bitfield_ro/
+func HandleBITFIELD_RO(client *Client, w *r.Writer, contents []string) {
+	bitfieldGeneric(w, contents, true)
+}
@@ -0,0 +1,552 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+// the latest expiration time of a field, in unix time in milliseconds
+// (redis' HFE_MAX_ABS_TIME_MSEC)
+const maxFieldExpireAt = 1<<48 - 1
+
+// hashes with fields that have an expiration time, sampled by the active
+// expire cycle. A key may outlive its hash (e.g. after a DEL), the cycle
+// forgets it once it finds out.
+var volatileHashes = map[string]struct{}{}
+
+// loadHash returns the hash stored at key, and whether it exists, after
+// deleting its expired fields. The key is deleted once its last field
+// expired. errWrongType is returned when key holds another type.
+func loadHash(key string) (*hash, bool, error) {
+	value, ok := db.Load(key)
+	if !ok {
+		return nil, false, nil
+	}
+	h, ok := value.(*hash)
+	if !ok {
+		return nil, false, errWrongType
+	}
+	if h.reclaim(now()) > 0 && h.Len() == 0 {
+		db.LoadAndDelete(key)
+		return nil, false, nil
+	}
+	return h, true, nil
+}
+
+// loadOrCreateHash returns the hash stored at key, storing an empty one if
+// the key doesn't exist.
+func loadOrCreateHash(key string) (*hash, error) {
+	h, exists, err := loadHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		h = newHash()
+		db.Store(key, h)
+	}
+	return h, nil
+}
+
+// activeExpireFields samples hashes with fields that have an expiration
+// time and deletes their expired fields, the way the active expire cycle
+// does with keys. It returns the number of deleted fields, executionLock
+// must be held.
+func activeExpireFields() int {
+	deadline := time.Now().Add(activeExpireBudget)
+	deleted := 0
+	for {
+		sampled, expired := 0, 0
+		timestamp := now()
+		for key := range volatileHashes {
+			if sampled == activeExpireSamples {
+				break
+			}
+			sampled++
+			value, _ := db.Load(key)
+			h, ok := value.(*hash)
+			if !ok || !h.Volatile() {
+				delete(volatileHashes, key)
+				continue
+			}
+			if n := h.reclaim(timestamp); n > 0 {
+				deleted += n
+				expired++
+				if h.Len() == 0 {
+					db.LoadAndDelete(key)
+				}
+				if !h.Volatile() {
+					delete(volatileHashes, key)
+				}
+			}
+		}
+
+		if sampled == 0 || float64(expired) <= activeExpireThreshold*float64(sampled) || time.Now().After(deadline) {
+			return deleted
+		}
+	}
+}
+
+// ActiveExpireFieldsCycle runs a single active expire cycle over hash
+// fields, returning the number of expired fields it deleted.
+func ActiveExpireFieldsCycle() int {
+	executionLock.Lock()
+	defer executionLock.Unlock()
+	return activeExpireFields()
+}
+
+// https://redis.io/commands/hset/
+func HandleHSET(client *Client, w *r.Writer, contents []string) {
+	if len(contents)%2 != 0 {
+		w.WriteError(fmt.Errorf("wrong number of arguments for 'hset' command"))
+		return
+	}
+	h, err := loadOrCreateHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	added := 0
+	for i := 2; i < len(contents); i += 2 {
+		if h.Set(contents[i], contents[i+1]) {
+			added++
+		}
+	}
+	w.WriteInteger(int64(added))
+}
+
+// https://redis.io/commands/hsetnx/
+func HandleHSETNX(client *Client, w *r.Writer, contents []string) {
+	h, err := loadOrCreateHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if _, ok := h.Get(contents[2]); ok {
+		w.WriteInteger(0)
+		return
+	}
+	h.Set(contents[2], contents[3])
+	w.WriteInteger(1)
+}
+
+// https://redis.io/commands/hget/
+func HandleHGET(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	value, ok := h.Get(contents[2])
+	if !ok {
+		w.WriteNull()
+		return
+	}
+	w.WriteBulkString(value)
+}
+
+// https://redis.io/commands/hmget/
+func HandleHMGET(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	fields := contents[2:]
+	w.WriteArrayHeader(len(fields))
+	for _, field := range fields {
+		if value, ok := h.Get(field); ok {
+			w.WriteBulkString(value)
+		} else {
+			w.WriteNull()
+		}
+	}
+}
+
+// https://redis.io/commands/hdel/
+func HandleHDEL(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	h, exists, err := loadHash(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteInteger(0)
+		return
+	}
+
+	deleted := 0
+	for _, field := range contents[2:] {
+		if h.Delete(field) {
+			deleted++
+		}
+	}
+	// a hash left without fields is deleted
+	if h.Len() == 0 {
+		db.LoadAndDelete(key)
+	}
+	w.WriteInteger(int64(deleted))
+}
+
+// https://redis.io/commands/hexists/
+func HandleHEXISTS(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if _, ok := h.Get(contents[2]); ok {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+}
+
+// https://redis.io/commands/hlen/
+func HandleHLEN(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteInteger(int64(h.Len()))
+}
+
+// https://redis.io/commands/hstrlen/
+func HandleHSTRLEN(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	value, _ := h.Get(contents[2])
+	w.WriteInteger(int64(len(value)))
+}
+
+// https://redis.io/commands/hkeys/
+func HandleHKEYS(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteArrayHeader(h.Len())
+	for field := range h.Fields() {
+		w.WriteBulkString(field)
+	}
+}
+
+// https://redis.io/commands/hvals/
+func HandleHVALS(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteArrayHeader(h.Len())
+	for _, value := range h.Fields() {
+		w.WriteBulkString(value)
+	}
+}
+
+// https://redis.io/commands/hgetall/
+func HandleHGETALL(client *Client, w *r.Writer, contents []string) {
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteMapHeader(h.Len())
+	for field, value := range h.Fields() {
+		w.WriteBulkString(field)
+		w.WriteBulkString(value)
+	}
+}
+
+// https://redis.io/commands/hincrby/
+func HandleHINCRBY(client *Client, w *r.Writer, contents []string) {
+	increment, err := parseInteger(contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	h, err := loadOrCreateHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	var intValue int64
+	if value, ok := h.Get(contents[2]); ok {
+		intValue, err = parseInteger(value)
+		if err != nil {
+			w.WriteError(errors.New("hash value is not an integer"))
+			return
+		}
+	}
+	if (increment < 0 && intValue < math.MinInt64-increment) || (increment > 0 && intValue > math.MaxInt64-increment) {
+		w.WriteError(fmt.Errorf("increment or decrement would overflow"))
+		return
+	}
+
+	intValue += increment
+	h.Update(contents[2], strconv.FormatInt(intValue, 10))
+	w.WriteInteger(intValue)
+}
+
+// https://redis.io/commands/hincrbyfloat/
+func HandleHINCRBYFLOAT(client *Client, w *r.Writer, contents []string) {
+	increment, err := parseFloat(contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	// anything added to or from infinity is either infinite or NaN
+	errInfinity := fmt.Errorf("increment would produce NaN or Infinity")
+	if increment.IsInf() {
+		w.WriteError(errInfinity)
+		return
+	}
+	h, err := loadOrCreateHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	floatValue := new(big.Float).SetPrec(longDoublePrecision)
+	if value, ok := h.Get(contents[2]); ok {
+		floatValue, err = parseFloat(value)
+		if err != nil {
+			w.WriteError(errors.New("hash value is not a float"))
+			return
+		}
+	}
+	if floatValue.IsInf() {
+		w.WriteError(errInfinity)
+		return
+	}
+
+	if exceedsLongDouble(floatValue.Add(floatValue, increment)) {
+		w.WriteError(errInfinity)
+		return
+	}
+	result := formatFloat(floatValue)
+	h.Update(contents[2], result)
+	w.WriteBulkString(result)
+}
+
+// parseFields parses the FIELDS numfields field [field ...] arguments
+// starting at contents[i], which end the command.
+func parseFields(contents []string, i int) ([]string, error) {
+	if i >= len(contents) || strings.ToUpper(contents[i]) != "FIELDS" {
+		return nil, errors.New("Mandatory argument FIELDS is missing or not at the right position")
+	}
+	if i+1 == len(contents) {
+		return nil, errSyntax
+	}
+	numFields, err := strconv.ParseInt(contents[i+1], 10, 64)
+	if err != nil || numFields <= 0 {
+		return nil, errors.New("Parameter `numFields` should be greater than 0")
+	}
+	fields := contents[i+2:]
+	if numFields != int64(len(fields)) {
+		return nil, errors.New("The `numfields` parameter must match the number of arguments")
+	}
+	return fields, nil
+}
+
+// shared by HEXPIRE, HPEXPIRE, HEXPIREAT and HPEXPIREAT: the expiration time
+// in milliseconds is base + contents[2]*unit. Replies for every field with
+// -2 when it doesn't exist, 0 when the condition wasn't met, 1 when the
+// expiration time was set, and 2 when the field was deleted because the
+// time already passed.
+func hexpireGeneric(w *r.Writer, contents []string, base int64, unit int64) {
+	key := contents[1]
+	command := strings.ToLower(contents[0])
+	amount, err := strconv.ParseInt(contents[2], 10, 64)
+	if err != nil {
+		w.WriteError(errNotInteger)
+		return
+	}
+	if amount < 0 {
+		w.WriteError(fmt.Errorf("invalid expire time, must be >= 0"))
+		return
+	}
+	if amount > maxFieldExpireAt/unit {
+		w.WriteError(fmt.Errorf("invalid expire time in '%s' command", command))
+		return
+	}
+	expireAt := base + amount*unit
+	if expireAt > maxFieldExpireAt {
+		w.WriteError(fmt.Errorf("invalid expire time in '%s' command", command))
+		return
+	}
+
+	i := 3
+	nx, xx, gt, lt := false, false, false, false
+	switch strings.ToUpper(contents[i]) {
+	case "NX":
+		nx = true
+		i++
+	case "XX":
+		xx = true
+		i++
+	case "GT":
+		gt = true
+		i++
+	case "LT":
+		lt = true
+		i++
+	}
+	fields, err := parseFields(contents, i)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	h, exists, err := loadHash(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteArrayHeader(len(fields))
+	if !exists {
+		for range fields {
+			w.WriteInteger(-2)
+		}
+		return
+	}
+
+	allowed := expireCondition(nx, xx, gt, lt, expireAt)
+	for _, field := range fields {
+		if _, ok := h.Get(field); !ok {
+			w.WriteInteger(-2)
+		} else if !allowed(h.ExpireAt(field)) {
+			w.WriteInteger(0)
+		} else if expireAt <= now() {
+			h.Delete(field)
+			w.WriteInteger(2)
+		} else {
+			h.Expire(field, expireAt)
+			volatileHashes[key] = struct{}{}
+			w.WriteInteger(1)
+		}
+	}
+	if h.Len() == 0 {
+		db.LoadAndDelete(key)
+	}
+}
+
+// https://redis.io/commands/hexpire/
+func HandleHEXPIRE(client *Client, w *r.Writer, contents []string) {
+	hexpireGeneric(w, contents, now(), 1000)
+}
+
+// https://redis.io/commands/hpexpire/
+func HandleHPEXPIRE(client *Client, w *r.Writer, contents []string) {
+	hexpireGeneric(w, contents, now(), 1)
+}
+
+// https://redis.io/commands/hexpireat/
+func HandleHEXPIREAT(client *Client, w *r.Writer, contents []string) {
+	hexpireGeneric(w, contents, 0, 1000)
+}
+
+// https://redis.io/commands/hpexpireat/
+func HandleHPEXPIREAT(client *Client, w *r.Writer, contents []string) {
+	hexpireGeneric(w, contents, 0, 1)
+}
+
+// shared by HTTL, HPTTL, HEXPIRETIME and HPEXPIRETIME, replies for every
+// field with -2 when it doesn't exist and -1 when it has no expiration time
+func httlGeneric(w *r.Writer, contents []string, milliseconds bool, absolute bool) {
+	fields, err := parseFields(contents, 2)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	w.WriteArrayHeader(len(fields))
+	for _, field := range fields {
+		if _, ok := h.Get(field); !ok {
+			w.WriteInteger(-2)
+			continue
+		}
+		expireAt := h.ExpireAt(field)
+		if expireAt == 0 {
+			w.WriteInteger(-1)
+			continue
+		}
+
+		value := expireAt
+		if !absolute {
+			value = max(expireAt-now(), 0)
+		}
+		if !milliseconds {
+			if absolute {
+				value /= 1000
+			} else {
+				value = (value + 500) / 1000
+			}
+		}
+		w.WriteInteger(value)
+	}
+}
+
+// https://redis.io/commands/httl/
+func HandleHTTL(client *Client, w *r.Writer, contents []string) {
+	httlGeneric(w, contents, false, false)
+}
+
+// https://redis.io/commands/hpttl/
+func HandleHPTTL(client *Client, w *r.Writer, contents []string) {
+	httlGeneric(w, contents, true, false)
+}
+
+// https://redis.io/commands/hexpiretime/
+func HandleHEXPIRETIME(client *Client, w *r.Writer, contents []string) {
+	httlGeneric(w, contents, false, true)
+}
+
+// https://redis.io/commands/hpexpiretime/
+func HandleHPEXPIRETIME(client *Client, w *r.Writer, contents []string) {
+	httlGeneric(w, contents, true, true)
+}
+
+// https://redis.io/commands/hpersist/
+func HandleHPERSIST(client *Client, w *r.Writer, contents []string) {
+	fields, err := parseFields(contents, 2)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	h, _, err := loadHash(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	w.WriteArrayHeader(len(fields))
+	for _, field := range fields {
+		if _, ok := h.Get(field); !ok {
+			w.WriteInteger(-2)
+		} else if h.Persist(field) {
+			w.WriteInteger(1)
+		} else {
+			w.WriteInteger(-1)
+		}
+	}
+}
@@ -0,0 +1,665 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+var errNotPositive = errors.New("value is out of range, must be positive")
+
+// loadList returns the list stored at key, and whether it exists.
+// errWrongType is returned when key holds another type.
+func loadList(key string) (*deque, bool, error) {
+	value, ok := db.Load(key)
+	if !ok {
+		return nil, false, nil
+	}
+	list, ok := value.(*deque)
+	if !ok {
+		return nil, false, errWrongType
+	}
+	return list, true, nil
+}
+
+// deleteIfEmpty deletes key once the list stored there has no elements left.
+func deleteIfEmpty(key string, list *deque) {
+	if list.Len() == 0 {
+		db.LoadAndDelete(key)
+	}
+}
+
+// listIndex turns index, negative counting from the end, into an offset of
+// a list of length elements. ok is false when it is out of range.
+func listIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// pushGeneric implements LPUSH and RPUSH, pushing to the head when left.
+func pushGeneric(w *r.Writer, contents []string, left bool) {
+	key := contents[1]
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		list = newDeque()
+		db.Store(key, list)
+	}
+
+	for _, element := range contents[2:] {
+		if left {
+			list.PushFront(element)
+		} else {
+			list.PushBack(element)
+		}
+	}
+	signalKeyAsReady(key)
+	w.WriteInteger(int64(list.Len()))
+}
+
+// popGeneric implements LPOP and RPOP, popping from the head when left.
+func popGeneric(w *r.Writer, contents []string, left bool) {
+	key := contents[1]
+	if len(contents) > 3 {
+		w.WriteError(errSyntax)
+		return
+	}
+	withCount := len(contents) == 3
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = parseInteger(contents[2])
+		if err != nil || count < 0 {
+			w.WriteError(errNotPositive)
+			return
+		}
+	}
+
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		if withCount {
+			w.WriteNullArray()
+		} else {
+			w.WriteNull()
+		}
+		return
+	}
+
+	n := int(min(count, int64(list.Len())))
+	popped := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if left {
+			popped = append(popped, list.PopFront())
+		} else {
+			popped = append(popped, list.PopBack())
+		}
+	}
+	deleteIfEmpty(key, list)
+
+	if withCount {
+		w.WriteStringArray(popped)
+	} else {
+		w.WriteBulkString(popped[0])
+	}
+}
+
+// https://redis.io/commands/lpop/
+func HandleLPOP(client *Client, w *r.Writer, contents []string) {
+	popGeneric(w, contents, true)
+}
+
+// https://redis.io/commands/rpop/
+func HandleRPOP(client *Client, w *r.Writer, contents []string) {
+	popGeneric(w, contents, false)
+}
+
+// https://redis.io/commands/llen/
+func HandleLLEN(client *Client, w *r.Writer, contents []string) {
+	list, _, err := loadList(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteInteger(int64(list.Len()))
+}
+
+// https://redis.io/commands/lindex/
+func HandleLINDEX(client *Client, w *r.Writer, contents []string) {
+	index, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	list, _, err := loadList(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	i, ok := listIndex(index, list.Len())
+	if !ok {
+		w.WriteNull()
+		return
+	}
+	w.WriteBulkString(list.At(i))
+}
+
+// https://redis.io/commands/lset/
+func HandleLSET(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	index, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteError(errors.New("no such key"))
+		return
+	}
+
+	i, ok := listIndex(index, list.Len())
+	if !ok {
+		w.WriteError(errors.New("index out of range"))
+		return
+	}
+	list.Set(i, contents[3])
+	w.WriteOK()
+}
+
+// https://redis.io/commands/linsert/
+func HandleLINSERT(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	var after bool
+	switch strings.ToUpper(contents[2]) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		w.WriteError(errSyntax)
+		return
+	}
+	pivot, element := contents[3], contents[4]
+
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteInteger(0)
+		return
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		if list.At(i) != pivot {
+			continue
+		}
+		if after {
+			i++
+		}
+		list.Insert(i, element)
+		w.WriteInteger(int64(list.Len()))
+		return
+	}
+	w.WriteInteger(-1)
+}
+
+// https://redis.io/commands/lrem/
+func HandleLREM(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	count, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	element := contents[3]
+
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteInteger(0)
+		return
+	}
+
+	// a negative count removes from the tail, 0 removes every occurrence
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := int64(0)
+	remove := make([]bool, list.Len())
+	for n := 0; n < list.Len() && (limit == 0 || removed < limit); n++ {
+		i := n
+		if count < 0 {
+			i = list.Len() - 1 - n
+		}
+		if list.At(i) == element {
+			remove[i] = true
+			removed++
+		}
+	}
+	if removed == 0 {
+		w.WriteInteger(0)
+		return
+	}
+
+	list.Filter(func(i int, _ string) bool { return !remove[i] })
+	deleteIfEmpty(key, list)
+	w.WriteInteger(removed)
+}
+
+// https://redis.io/commands/ltrim/
+func HandleLTRIM(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	start, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	stop, err := parseInteger(contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteOK()
+		return
+	}
+
+	from, to, ok := clampRange(start, stop, list.Len())
+	if !ok {
+		from, to = 0, 0
+	}
+	for i := 0; i < from; i++ {
+		list.PopFront()
+	}
+	for list.Len() > to-from {
+		list.PopBack()
+	}
+	deleteIfEmpty(key, list)
+	w.WriteOK()
+}
+
+// https://redis.io/commands/lpos/
+func HandleLPOS(client *Client, w *r.Writer, contents []string) {
+	key, element := contents[1], contents[2]
+	rank, count, maxLen := int64(1), int64(0), int64(0)
+	withCount := false
+	for i := 3; i < len(contents); i += 2 {
+		option := strings.ToUpper(contents[i])
+		if i+1 == len(contents) {
+			w.WriteError(errSyntax)
+			return
+		}
+		value, err := parseInteger(contents[i+1])
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		switch option {
+		case "RANK":
+			// -rank must fit in an int64
+			if value == math.MinInt64 {
+				w.WriteError(fmt.Errorf("value is out of range, value must between %d and %d", -math.MaxInt64, math.MaxInt64))
+				return
+			}
+			if value == 0 {
+				w.WriteError(errors.New("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"))
+				return
+			}
+			rank = value
+		case "COUNT":
+			if value < 0 {
+				w.WriteError(errors.New("COUNT can't be negative"))
+				return
+			}
+			count, withCount = value, true
+		case "MAXLEN":
+			if value < 0 {
+				w.WriteError(errors.New("MAXLEN can't be negative"))
+				return
+			}
+			maxLen = value
+		default:
+			w.WriteError(errSyntax)
+			return
+		}
+	}
+
+	list, _, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	// a negative rank scans from the tail, skipping the first -rank-1 matches
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	var matches []int64
+	for n := 0; n < list.Len(); n++ {
+		if maxLen != 0 && int64(n) >= maxLen {
+			break
+		}
+		i := n
+		if rank < 0 {
+			i = list.Len() - 1 - n
+		}
+		if list.At(i) != element {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		matches = append(matches, int64(i))
+		// COUNT 0 returns every match
+		if !withCount || int64(len(matches)) == count {
+			break
+		}
+	}
+
+	if !withCount {
+		if len(matches) == 0 {
+			w.WriteNull()
+			return
+		}
+		w.WriteInteger(matches[0])
+		return
+	}
+	w.WriteArrayHeader(len(matches))
+	for _, i := range matches {
+		w.WriteInteger(i)
+	}
+}
+
+// parseDirection parses the LEFT or RIGHT argument of list moves.
+func parseDirection(arg string) (left bool, err error) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, errSyntax
+}
+
+// moveElement pops an element from the source list and pushes it to the
+// destination list, replying with the element. It returns false, without
+// replying, when source doesn't exist.
+func moveElement(w *r.Writer, source string, destination string, fromLeft bool, toLeft bool) bool {
+	sourceList, exists, err := loadList(source)
+	if err != nil {
+		w.WriteError(err)
+		return true
+	}
+	if !exists {
+		return false
+	}
+	destinationList, exists, err := loadList(destination)
+	if err != nil {
+		w.WriteError(err)
+		return true
+	}
+
+	var element string
+	if fromLeft {
+		element = sourceList.PopFront()
+	} else {
+		element = sourceList.PopBack()
+	}
+	if !exists {
+		destinationList = newDeque()
+		db.Store(destination, destinationList)
+	}
+	if toLeft {
+		destinationList.PushFront(element)
+	} else {
+		destinationList.PushBack(element)
+	}
+	// source and destination may be the same list
+	deleteIfEmpty(source, sourceList)
+	signalKeyAsReady(destination)
+
+	w.WriteBulkString(element)
+	return true
+}
+
+// popMany pops up to count elements from the list at key, replying with the
+// key and the elements. It returns false, without replying, when key doesn't
+// exist.
+func popMany(w *r.Writer, key string, left bool, count int64) bool {
+	list, exists, err := loadList(key)
+	if err != nil {
+		w.WriteError(err)
+		return true
+	}
+	if !exists {
+		return false
+	}
+
+	n := int(min(count, int64(list.Len())))
+	w.WriteArrayHeader(2)
+	w.WriteBulkString(key)
+	w.WriteArrayHeader(n)
+	for i := 0; i < n; i++ {
+		if left {
+			w.WriteBulkString(list.PopFront())
+		} else {
+			w.WriteBulkString(list.PopBack())
+		}
+	}
+	deleteIfEmpty(key, list)
+	return true
+}
+
+// parseMPop parses the numkeys key [key ...] LEFT|RIGHT [COUNT count]
+// arguments of LMPOP and BLMPOP, parseEnd parsing the end to pop from
+// (MIN|MAX for ZMPOP and BZMPOP).
+func parseMPop(args []string, parseEnd func(arg string) (bool, error)) (keys []string, left bool, count int64, err error) {
+	numKeys, err := parseInteger(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, errors.New("numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-2) {
+		return nil, false, 0, errSyntax
+	}
+	keys = args[1 : 1+numKeys]
+	args = args[1+numKeys:]
+
+	if left, err = parseEnd(args[0]); err != nil {
+		return nil, false, 0, err
+	}
+	count = 1
+	switch {
+	case len(args) == 1:
+	case len(args) == 3 && strings.ToUpper(args[1]) == "COUNT":
+		count, err = parseInteger(args[2])
+		if err != nil || count <= 0 {
+			return nil, false, 0, errors.New("count should be greater than 0")
+		}
+	default:
+		return nil, false, 0, errSyntax
+	}
+	return keys, left, count, nil
+}
+
+// mpopKeys finds the keys of commands whose numkeys argument is at position
+// first, followed by the keys (e.g. LMPOP, BLMPOP and SINTERCARD).
+func mpopKeys(first int) func(args []string) []string {
+	return func(args []string) []string {
+		numKeys, err := parseInteger(args[first])
+		if err != nil || numKeys <= 0 || numKeys > int64(len(args)-first-1) {
+			return nil
+		}
+		return args[first+1 : first+1+int(numKeys)]
+	}
+}
+
+// https://redis.io/commands/lmove/
+func HandleLMOVE(client *Client, w *r.Writer, contents []string) {
+	fromLeft, err := parseDirection(contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	toLeft, err := parseDirection(contents[4])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !moveElement(w, contents[1], contents[2], fromLeft, toLeft) {
+		w.WriteNull()
+	}
+}
+
+// https://redis.io/commands/rpoplpush/
+func HandleRPOPLPUSH(client *Client, w *r.Writer, contents []string) {
+	if !moveElement(w, contents[1], contents[2], false, true) {
+		w.WriteNull()
+	}
+}
+
+// https://redis.io/commands/lmpop/
+func HandleLMPOP(client *Client, w *r.Writer, contents []string) {
+	keys, left, count, err := parseMPop(contents[1:], parseDirection)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	for _, key := range keys {
+		if popMany(w, key, left, count) {
+			return
+		}
+	}
+	w.WriteNullArray()
+}
+
+// blockingPopGeneric implements BLPOP and BRPOP, popping from the head when
+// left.
+func blockingPopGeneric(client *Client, w *r.Writer, contents []string, left bool) {
+	keys := contents[1 : len(contents)-1]
+	timeout, err := parseTimeout(contents[len(contents)-1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	serve := func(w *r.Writer, key string) bool {
+		list, exists, err := loadList(key)
+		if err != nil {
+			w.WriteError(err)
+			return true
+		}
+		if !exists {
+			return false
+		}
+		var element string
+		if left {
+			element = list.PopFront()
+		} else {
+			element = list.PopBack()
+		}
+		deleteIfEmpty(key, list)
+		w.WriteStringArray([]string{key, element})
+		return true
+	}
+	for _, key := range keys {
+		if serve(w, key) {
+			return
+		}
+	}
+	blockClient(client, w, keys, isList, timeout, serve, (*r.Writer).WriteNullArray)
+}
+
+// https://redis.io/commands/blpop/
+func HandleBLPOP(client *Client, w *r.Writer, contents []string) {
+	blockingPopGeneric(client, w, contents, true)
+}
+
+// https://redis.io/commands/brpop/
+func HandleBRPOP(client *Client, w *r.Writer, contents []string) {
+	blockingPopGeneric(client, w, contents, false)
+}
+
+// https://redis.io/commands/blmove/
+func HandleBLMOVE(client *Client, w *r.Writer, contents []string) {
+	source, destination := contents[1], contents[2]
+	fromLeft, err := parseDirection(contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	toLeft, err := parseDirection(contents[4])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	timeout, err := parseTimeout(contents[5])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	serve := func(w *r.Writer, _ string) bool {
+		return moveElement(w, source, destination, fromLeft, toLeft)
+	}
+	if serve(w, source) {
+		return
+	}
+	blockClient(client, w, []string{source}, isList, timeout, serve, (*r.Writer).WriteNull)
+}
+
+// https://redis.io/commands/blmpop/
+func HandleBLMPOP(client *Client, w *r.Writer, contents []string) {
+	timeout, err := parseTimeout(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	keys, left, count, err := parseMPop(contents[2:], parseDirection)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	serve := func(w *r.Writer, key string) bool {
+		return popMany(w, key, left, count)
+	}
+	for _, key := range keys {
+		if serve(w, key) {
+			return
+		}
+	}
+	blockClient(client, w, keys, isList, timeout, serve, (*r.Writer).WriteNullArray)
+}
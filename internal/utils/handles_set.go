@@ -0,0 +1,485 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+// set is the value of set keys, an unordered collection of unique members.
+// https://redis.io/docs/data-types/sets/
+type set map[string]struct{}
+
+// loadSet returns the set stored at key, and whether it exists.
+// errWrongType is returned when key holds another type.
+func loadSet(key string) (set, bool, error) {
+	value, ok := db.Load(key)
+	if !ok {
+		return nil, false, nil
+	}
+	s, ok := value.(set)
+	if !ok {
+		return nil, false, errWrongType
+	}
+	return s, true, nil
+}
+
+// loadSets returns the sets stored at keys, nil for the ones that don't
+// exist.
+func loadSets(keys []string) ([]set, error) {
+	sets := make([]set, len(keys))
+	for i, key := range keys {
+		s, _, err := loadSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// members returns the members of s in no particular order.
+func (s set) members() []string {
+	members := make([]string, 0, len(s))
+	for member := range s {
+		members = append(members, member)
+	}
+	return members
+}
+
+// randomMember returns a random member of a non empty set. Map iteration
+// starts at a random position, which makes for a cheap random pick.
+func (s set) randomMember() string {
+	for member := range s {
+		return member
+	}
+	return ""
+}
+
+// pickRandom moves n random members of members to its front, n must not
+// exceed its length.
+func pickRandom(members []string, n int) []string {
+	for i := 0; i < n; i++ {
+		j := i + rand.Intn(len(members)-i)
+		members[i], members[j] = members[j], members[i]
+	}
+	return members[:n]
+}
+
+func writeSet(w *r.Writer, s set) {
+	w.WriteSetHeader(len(s))
+	for member := range s {
+		w.WriteBulkString(member)
+	}
+}
+
+// https://redis.io/commands/sadd/
+func HandleSADD(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	s, exists, err := loadSet(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		s = set{}
+		db.Store(key, s)
+	}
+
+	added := 0
+	for _, member := range contents[2:] {
+		if _, ok := s[member]; !ok {
+			s[member] = struct{}{}
+			added++
+		}
+	}
+	w.WriteInteger(int64(added))
+}
+
+// https://redis.io/commands/srem/
+func HandleSREM(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	s, _, err := loadSet(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	removed := 0
+	for _, member := range contents[2:] {
+		if _, ok := s[member]; ok {
+			delete(s, member)
+			removed++
+		}
+	}
+	// a set left without members is deleted
+	if removed > 0 && len(s) == 0 {
+		db.LoadAndDelete(key)
+	}
+	w.WriteInteger(int64(removed))
+}
+
+// https://redis.io/commands/sismember/
+func HandleSISMEMBER(client *Client, w *r.Writer, contents []string) {
+	s, _, err := loadSet(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if _, ok := s[contents[2]]; ok {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+}
+
+// https://redis.io/commands/smismember/
+func HandleSMISMEMBER(client *Client, w *r.Writer, contents []string) {
+	s, _, err := loadSet(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	members := contents[2:]
+	w.WriteArrayHeader(len(members))
+	for _, member := range members {
+		if _, ok := s[member]; ok {
+			w.WriteInteger(1)
+		} else {
+			w.WriteInteger(0)
+		}
+	}
+}
+
+// https://redis.io/commands/scard/
+func HandleSCARD(client *Client, w *r.Writer, contents []string) {
+	s, _, err := loadSet(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteInteger(int64(len(s)))
+}
+
+// https://redis.io/commands/smembers/
+func HandleSMEMBERS(client *Client, w *r.Writer, contents []string) {
+	s, _, err := loadSet(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	writeSet(w, s)
+}
+
+// https://redis.io/commands/spop/
+func HandleSPOP(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	if len(contents) > 3 {
+		w.WriteError(errSyntax)
+		return
+	}
+	withCount := len(contents) == 3
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = parseInteger(contents[2])
+		if err != nil || count < 0 {
+			w.WriteError(errNotPositive)
+			return
+		}
+	}
+
+	s, exists, err := loadSet(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !withCount {
+		if !exists {
+			w.WriteNull()
+			return
+		}
+		member := s.randomMember()
+		delete(s, member)
+		if len(s) == 0 {
+			db.LoadAndDelete(key)
+		}
+		w.WriteBulkString(member)
+		return
+	}
+
+	// the whole set is popped when count exceeds its size
+	if count >= int64(len(s)) {
+		if exists {
+			db.LoadAndDelete(key)
+		}
+		writeSet(w, s)
+		return
+	}
+	popped := pickRandom(s.members(), int(count))
+	w.WriteSetHeader(len(popped))
+	for _, member := range popped {
+		delete(s, member)
+		w.WriteBulkString(member)
+	}
+}
+
+// https://redis.io/commands/srandmember/
+func HandleSRANDMEMBER(client *Client, w *r.Writer, contents []string) {
+	if len(contents) > 3 {
+		w.WriteError(errSyntax)
+		return
+	}
+	withCount := len(contents) == 3
+	var count int64
+	if withCount {
+		var err error
+		count, err = parseInteger(contents[2])
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		if count < -math.MaxInt64/2 {
+			w.WriteError(errors.New("value is out of range"))
+			return
+		}
+	}
+
+	s, exists, err := loadSet(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !withCount {
+		if !exists {
+			w.WriteNull()
+			return
+		}
+		w.WriteBulkString(s.randomMember())
+		return
+	}
+	if !exists || count == 0 {
+		w.WriteArrayHeader(0)
+		return
+	}
+
+	members := s.members()
+	// a negative count may return the same member multiple times
+	if count < 0 {
+		w.WriteArrayHeader(int(-count))
+		for i := int64(0); i < -count; i++ {
+			w.WriteBulkString(members[rand.Intn(len(members))])
+		}
+		return
+	}
+	w.WriteStringArray(pickRandom(members, int(min(count, int64(len(members))))))
+}
+
+// https://redis.io/commands/smove/
+func HandleSMOVE(client *Client, w *r.Writer, contents []string) {
+	source, destination, member := contents[1], contents[2], contents[3]
+	src, exists, err := loadSet(source)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteInteger(0)
+		return
+	}
+	dst, dstExists, err := loadSet(destination)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if _, ok := src[member]; !ok {
+		w.WriteInteger(0)
+		return
+	}
+	if source == destination {
+		w.WriteInteger(1)
+		return
+	}
+
+	delete(src, member)
+	if len(src) == 0 {
+		db.LoadAndDelete(source)
+	}
+	if !dstExists {
+		dst = set{}
+		db.Store(destination, dst)
+	}
+	dst[member] = struct{}{}
+	w.WriteInteger(1)
+}
+
+type setOp int
+
+const (
+	setInter setOp = iota
+	setUnion
+	setDiff
+)
+
+// setAlgebra returns the intersection, union or difference (of the first
+// set and the others) of sets, a missing set being empty.
+func setAlgebra(op setOp, sets []set) set {
+	result := set{}
+	switch op {
+	case setInter:
+		// the smallest set bounds the intersection
+		smallest := sets[0]
+		for _, s := range sets[1:] {
+			if len(s) < len(smallest) {
+				smallest = s
+			}
+		}
+	members:
+		for member := range smallest {
+			for _, s := range sets {
+				if _, ok := s[member]; !ok {
+					continue members
+				}
+			}
+			result[member] = struct{}{}
+		}
+	case setUnion:
+		for _, s := range sets {
+			for member := range s {
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+	diff:
+		for member := range sets[0] {
+			for _, s := range sets[1:] {
+				if _, ok := s[member]; ok {
+					continue diff
+				}
+			}
+			result[member] = struct{}{}
+		}
+	}
+	return result
+}
+
+// shared by SINTER, SUNION and SDIFF
+func setAlgebraGeneric(w *r.Writer, keys []string, op setOp) {
+	sets, err := loadSets(keys)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	writeSet(w, setAlgebra(op, sets))
+}
+
+// shared by SINTERSTORE, SUNIONSTORE and SDIFFSTORE, an empty result
+// deletes the destination
+func setAlgebraStoreGeneric(w *r.Writer, destination string, keys []string, op setOp) {
+	sets, err := loadSets(keys)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	result := setAlgebra(op, sets)
+	if len(result) == 0 {
+		db.LoadAndDelete(destination)
+	} else {
+		db.Store(destination, result)
+	}
+	w.WriteInteger(int64(len(result)))
+}
+
+// https://redis.io/commands/sinter/
+func HandleSINTER(client *Client, w *r.Writer, contents []string) {
+	setAlgebraGeneric(w, contents[1:], setInter)
+}
+
+// https://redis.io/commands/sunion/
+func HandleSUNION(client *Client, w *r.Writer, contents []string) {
+	setAlgebraGeneric(w, contents[1:], setUnion)
+}
+
+// https://redis.io/commands/sdiff/
+func HandleSDIFF(client *Client, w *r.Writer, contents []string) {
+	setAlgebraGeneric(w, contents[1:], setDiff)
+}
+
+// https://redis.io/commands/sinterstore/
+func HandleSINTERSTORE(client *Client, w *r.Writer, contents []string) {
+	setAlgebraStoreGeneric(w, contents[1], contents[2:], setInter)
+}
+
+// https://redis.io/commands/sunionstore/
+func HandleSUNIONSTORE(client *Client, w *r.Writer, contents []string) {
+	setAlgebraStoreGeneric(w, contents[1], contents[2:], setUnion)
+}
+
+// https://redis.io/commands/sdiffstore/
+func HandleSDIFFSTORE(client *Client, w *r.Writer, contents []string) {
+	setAlgebraStoreGeneric(w, contents[1], contents[2:], setDiff)
+}
+
+// https://redis.io/commands/sintercard/
+func HandleSINTERCARD(client *Client, w *r.Writer, contents []string) {
+	numKeys, err := parseInteger(contents[1])
+	if err != nil || numKeys <= 0 {
+		w.WriteError(errors.New("numkeys should be greater than 0"))
+		return
+	}
+	if numKeys > int64(len(contents)-2) {
+		w.WriteError(errors.New("Number of keys can't be greater than number of args"))
+		return
+	}
+	keys := contents[2 : 2+numKeys]
+	args := contents[2+numKeys:]
+
+	// 0 is no limit
+	var limit int64
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && strings.ToUpper(args[0]) == "LIMIT":
+		limit, err = parseInteger(args[1])
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		if limit < 0 {
+			w.WriteError(errors.New("LIMIT can't be negative"))
+			return
+		}
+	default:
+		w.WriteError(errSyntax)
+		return
+	}
+
+	sets, err := loadSets(keys)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	smallest := sets[0]
+	for _, s := range sets[1:] {
+		if len(s) < len(smallest) {
+			smallest = s
+		}
+	}
+	// counting stops at the limit, without computing the whole intersection
+	var count int64
+members:
+	for member := range smallest {
+		for _, s := range sets {
+			if _, ok := s[member]; !ok {
+				continue members
+			}
+		}
+		count++
+		if count == limit {
+			break
+		}
+	}
+	w.WriteInteger(count)
+}
@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+// https://redis.io/docs/reference/protocol-spec/#bulk-strings
+const maxStringLen = 512 * 1024 * 1024
+
+// loadString returns the string stored at key, and whether it exists.
+// errWrongType is returned when key holds another type.
+func loadString(key string) (string, bool, error) {
+	value, ok := db.Load(key)
+	if !ok {
+		return "", false, nil
+	}
+	stringValue, ok := value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return stringValue, true, nil
+}
+
+// clampRange turns the inclusive start and stop offsets of a range, where
+// negative offsets count from the end, into slice bounds of a sequence of
+// length elements. ok is false when the range is empty.
+func clampRange(start int64, stop int64, length int) (from int, to int, ok bool) {
+	if start < 0 {
+		start = max(int64(length)+start, 0)
+	}
+	if stop < 0 {
+		stop = int64(length) + stop
+	}
+	if start >= int64(length) || start > stop {
+		return 0, 0, false
+	}
+	stop = min(stop, int64(length)-1)
+	return int(start), int(stop) + 1, true
+}
+
+// https://redis.io/commands/append/
+func HandleAPPEND(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	value, _, err := loadString(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if len(value)+len(contents[2]) > maxStringLen {
+		w.WriteError(fmt.Errorf("string exceeds maximum allowed size (proto-max-bulk-len)"))
+		return
+	}
+
+	value += contents[2]
+	db.StoreKeepTTL(key, value)
+	w.WriteInteger(int64(len(value)))
+}
+
+// https://redis.io/commands/strlen/
+func HandleSTRLEN(client *Client, w *r.Writer, contents []string) {
+	value, _, err := loadString(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteInteger(int64(len(value)))
+}
+
+// https://redis.io/commands/getrange/
+func HandleGETRANGE(client *Client, w *r.Writer, contents []string) {
+	start, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	end, err := parseInteger(contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	value, _, err := loadString(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	from, to, ok := clampRange(start, end, len(value))
+	if !ok {
+		w.WriteBulkString("")
+		return
+	}
+	w.WriteBulkString(value[from:to])
+}
+
+// https://redis.io/commands/setrange/
+func HandleSETRANGE(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	offset, err := parseInteger(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if offset < 0 {
+		w.WriteError(fmt.Errorf("offset is out of range"))
+		return
+	}
+
+	value, exists, err := loadString(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	patch := contents[3]
+	// an empty patch doesn't create or grow the string
+	if len(patch) == 0 {
+		w.WriteInteger(int64(len(value)))
+		return
+	}
+	if offset+int64(len(patch)) > maxStringLen {
+		w.WriteError(fmt.Errorf("string exceeds maximum allowed size (proto-max-bulk-len)"))
+		return
+	}
+
+	buffer := []byte(value)
+	if end := int(offset) + len(patch); end > len(buffer) {
+		// the gap is padded with zero bytes
+		buffer = append(buffer, make([]byte, end-len(buffer))...)
+	}
+	copy(buffer[offset:], patch)
+
+	if exists {
+		db.StoreKeepTTL(key, string(buffer))
+	} else {
+		db.Store(key, string(buffer))
+	}
+	w.WriteInteger(int64(len(buffer)))
+}
+
+// https://redis.io/commands/getdel/
+func HandleGETDEL(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	value, exists, err := loadString(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteNull()
+		return
+	}
+	db.LoadAndDelete(key)
+	w.WriteBulkString(value)
+}
+
+// https://redis.io/commands/getex/
+func HandleGETEX(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+
+	persist := false
+	expireOption, expireArg := "", ""
+	for i := 2; i < len(contents); i++ {
+		option := strings.ToUpper(contents[i])
+		switch option {
+		case "PERSIST":
+			if expireOption != "" {
+				w.WriteError(errSyntax)
+				return
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if persist || expireOption != "" || i+1 == len(contents) {
+				w.WriteError(errSyntax)
+				return
+			}
+			expireOption, expireArg = option, contents[i+1]
+			i++
+		default:
+			w.WriteError(errSyntax)
+			return
+		}
+	}
+
+	var expireAt int64
+	if expireOption != "" {
+		var err error
+		expireAt, err = parseExpireTime(expireOption, expireArg, "getex")
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+	}
+
+	value, exists, err := loadString(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteNull()
+		return
+	}
+
+	if persist {
+		db.Persist(key)
+	} else if expireOption != "" {
+		db.Expire(key, expireAt, func(int64) bool { return true })
+	}
+	w.WriteBulkString(value)
+}
+
+// https://redis.io/commands/lcs/
+func HandleLCS(client *Client, w *r.Writer, contents []string) {
+	getLen, getIdx, withMatchLen := false, false, false
+	var minMatchLen int64
+	for i := 3; i < len(contents); i++ {
+		switch strings.ToUpper(contents[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 == len(contents) {
+				w.WriteError(errSyntax)
+				return
+			}
+			var err error
+			minMatchLen, err = parseInteger(contents[i+1])
+			if err != nil {
+				w.WriteError(err)
+				return
+			}
+			minMatchLen = max(minMatchLen, 0)
+			i++
+		default:
+			w.WriteError(errSyntax)
+			return
+		}
+	}
+	if getLen && getIdx {
+		w.WriteError(fmt.Errorf("If you want both the length and indexes, please just use IDX."))
+		return
+	}
+
+	a, _, err := loadString(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	b, _, err := loadString(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	// lcs[i][j] is the length of the LCS of a[:i] and b[:j]
+	lcs := make([][]uint32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]uint32, len(b)+1)
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				lcs[i][j] = lcs[i-1][j-1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i-1][j], lcs[i][j-1])
+			}
+		}
+	}
+
+	length := lcs[len(a)][len(b)]
+	if getLen {
+		w.WriteInteger(int64(length))
+		return
+	}
+
+	// walk the table back from the end, collecting the LCS and the ranges
+	// of a and b that match
+	// https://github.com/redis/redis/blob/7.2/src/t_string.c
+	type match struct {
+		aStart, aEnd, bStart, bEnd int
+	}
+	var matches []match
+	result := make([]byte, length)
+	idx := int(length)
+	aStart, aEnd, bStart, bEnd := len(a), 0, 0, 0
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == len(a) {
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			} else if aStart == i && bStart == j {
+				// the range is contiguous, extend it backward
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			// the first byte of either string ends the walk
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if lcs[i-1][j] > lcs[i][j-1] {
+				i--
+			} else {
+				j--
+			}
+			if aStart != len(a) {
+				emit = true
+			}
+		}
+
+		if emit {
+			if matchLen := aEnd - aStart + 1; int64(matchLen) >= minMatchLen {
+				matches = append(matches, match{aStart, aEnd, bStart, bEnd})
+			}
+			aStart = len(a)
+		}
+	}
+
+	if !getIdx {
+		w.WriteBulkString(string(result))
+		return
+	}
+
+	w.WriteMapHeader(2)
+	w.WriteBulkString("matches")
+	w.WriteArrayHeader(len(matches))
+	for _, m := range matches {
+		if withMatchLen {
+			w.WriteArrayHeader(3)
+		} else {
+			w.WriteArrayHeader(2)
+		}
+		w.WriteArrayHeader(2)
+		w.WriteInteger(int64(m.aStart))
+		w.WriteInteger(int64(m.aEnd))
+		w.WriteArrayHeader(2)
+		w.WriteInteger(int64(m.bStart))
+		w.WriteInteger(int64(m.bEnd))
+		if withMatchLen {
+			w.WriteInteger(int64(m.aEnd - m.aStart + 1))
+		}
+	}
+	w.WriteBulkString("len")
+	w.WriteInteger(int64(length))
+}
@@ -0,0 +1,1089 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+)
+
+var errScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+// loadZset returns the sorted set stored at key, and whether it exists.
+// errWrongType is returned when key holds another type.
+func loadZset(key string) (*zset, bool, error) {
+	value, ok := db.Load(key)
+	if !ok {
+		return nil, false, nil
+	}
+	z, ok := value.(*zset)
+	if !ok {
+		return nil, false, errWrongType
+	}
+	return z, true, nil
+}
+
+// parseScore parses the score of a sorted set member, which can be
+// infinite but not NaN.
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+// scoreBound is an end of a score range: score including it, (score
+// excluding it.
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+type scoreRange struct {
+	min, max scoreBound
+}
+
+func parseScoreBound(arg string) (scoreBound, error) {
+	bound := scoreBound{}
+	if strings.HasPrefix(arg, "(") {
+		bound.exclusive = true
+		arg = arg[1:]
+	}
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(value) {
+		return bound, errors.New("min or max is not a float")
+	}
+	bound.value = value
+	return bound, nil
+}
+
+func parseScoreRange(min string, max string) (scoreRange, error) {
+	var sr scoreRange
+	var err error
+	if sr.min, err = parseScoreBound(min); err != nil {
+		return sr, err
+	}
+	if sr.max, err = parseScoreBound(max); err != nil {
+		return sr, err
+	}
+	return sr, nil
+}
+
+func (sr scoreRange) aboveMin(score float64) bool {
+	if sr.min.exclusive {
+		return score > sr.min.value
+	}
+	return score >= sr.min.value
+}
+
+func (sr scoreRange) belowMax(score float64) bool {
+	if sr.max.exclusive {
+		return score < sr.max.value
+	}
+	return score <= sr.max.value
+}
+
+// lexBound is an end of a lexicographical range: [member including it,
+// (member excluding it, - and + the lowest and highest possible members.
+type lexBound struct {
+	value     string
+	exclusive bool
+	// -1 for -, 1 for +
+	infinity int
+}
+
+type lexRange struct {
+	min, max lexBound
+}
+
+func parseLexBound(arg string) (lexBound, error) {
+	switch {
+	case arg == "-":
+		return lexBound{infinity: -1}, nil
+	case arg == "+":
+		return lexBound{infinity: 1}, nil
+	case strings.HasPrefix(arg, "("):
+		return lexBound{value: arg[1:], exclusive: true}, nil
+	case strings.HasPrefix(arg, "["):
+		return lexBound{value: arg[1:]}, nil
+	}
+	return lexBound{}, errors.New("min or max not valid string range item")
+}
+
+func parseLexRange(min string, max string) (lexRange, error) {
+	var lr lexRange
+	var err error
+	if lr.min, err = parseLexBound(min); err != nil {
+		return lr, err
+	}
+	if lr.max, err = parseLexBound(max); err != nil {
+		return lr, err
+	}
+	return lr, nil
+}
+
+func (lr lexRange) aboveMin(member string) bool {
+	if lr.min.infinity != 0 {
+		return lr.min.infinity < 0
+	}
+	if lr.min.exclusive {
+		return member > lr.min.value
+	}
+	return member >= lr.min.value
+}
+
+func (lr lexRange) belowMax(member string) bool {
+	if lr.max.infinity != 0 {
+		return lr.max.infinity > 0
+	}
+	if lr.max.exclusive {
+		return member < lr.max.value
+	}
+	return member <= lr.max.value
+}
+
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec is a parsed ZRANGE query.
+type zrangeSpec struct {
+	by  int
+	rev bool
+	// the range, depending on by
+	start, stop int64
+	scores      scoreRange
+	lex         lexRange
+	// LIMIT, a negative count returns every member after offset
+	offset, count int64
+	withScores    bool
+}
+
+// parseZrange parses the start stop [BYSCORE | BYLEX] [REV]
+// [LIMIT offset count] [WITHSCORES] arguments of ZRANGE.
+func parseZrange(args []string) (zrangeSpec, error) {
+	spec := zrangeSpec{count: -1}
+	limit := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			spec.by = zrangeByScore
+		case "BYLEX":
+			spec.by = zrangeByLex
+		case "REV":
+			spec.rev = true
+		case "WITHSCORES":
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return spec, errSyntax
+			}
+			var err error
+			if spec.offset, err = parseInteger(args[i+1]); err != nil {
+				return spec, err
+			}
+			if spec.count, err = parseInteger(args[i+2]); err != nil {
+				return spec, err
+			}
+			limit = true
+			i += 2
+		default:
+			return spec, errSyntax
+		}
+	}
+	if limit && spec.by == zrangeByRank {
+		return spec, errors.New("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == zrangeByLex {
+		return spec, errors.New("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	// REV takes the maximum first
+	min, max := args[0], args[1]
+	if spec.rev {
+		min, max = max, min
+	}
+	var err error
+	switch spec.by {
+	case zrangeByRank:
+		if spec.start, err = parseInteger(args[0]); err != nil {
+			return spec, err
+		}
+		spec.stop, err = parseInteger(args[1])
+	case zrangeByScore:
+		spec.scores, err = parseScoreRange(min, max)
+	case zrangeByLex:
+		spec.lex, err = parseLexRange(min, max)
+	}
+	return spec, err
+}
+
+// next returns the node after x, going from the highest score when
+// reverse.
+func (x *zskiplistNode) next(reverse bool) *zskiplistNode {
+	if reverse {
+		return x.backward
+	}
+	return x.level[0].forward
+}
+
+// zrange returns the nodes of z in the range of spec, in order.
+func zrange(z *zset, spec zrangeSpec) []*zskiplistNode {
+	if z.Len() == 0 {
+		return nil
+	}
+	var nodes []*zskiplistNode
+
+	if spec.by == zrangeByRank {
+		from, to, ok := clampRange(spec.start, spec.stop, z.Len())
+		if !ok {
+			return nil
+		}
+		x := z.zsl.ByRank(from)
+		if spec.rev {
+			x = z.zsl.ByRank(z.Len() - 1 - from)
+		}
+		for i := from; i < to; i++ {
+			nodes = append(nodes, x)
+			x = x.next(spec.rev)
+		}
+		return nodes
+	}
+
+	// the range is walked from the node its start finds, until its end
+	var start, end func(n *zskiplistNode) bool
+	switch {
+	case spec.by == zrangeByScore && !spec.rev:
+		start = func(n *zskiplistNode) bool { return spec.scores.aboveMin(n.score) }
+		end = func(n *zskiplistNode) bool { return spec.scores.belowMax(n.score) }
+	case spec.by == zrangeByScore:
+		start = func(n *zskiplistNode) bool { return spec.scores.belowMax(n.score) }
+		end = func(n *zskiplistNode) bool { return spec.scores.aboveMin(n.score) }
+	case !spec.rev:
+		start = func(n *zskiplistNode) bool { return spec.lex.aboveMin(n.member) }
+		end = func(n *zskiplistNode) bool { return spec.lex.belowMax(n.member) }
+	default:
+		start = func(n *zskiplistNode) bool { return spec.lex.belowMax(n.member) }
+		end = func(n *zskiplistNode) bool { return spec.lex.aboveMin(n.member) }
+	}
+	var x *zskiplistNode
+	if spec.rev {
+		x = z.zsl.Last(start)
+	} else {
+		x = z.zsl.First(start)
+	}
+
+	if spec.offset < 0 {
+		return nil
+	}
+	for offset := spec.offset; x != nil && offset > 0 && end(x); offset-- {
+		x = x.next(spec.rev)
+	}
+	for count := spec.count; x != nil && count != 0 && end(x); count-- {
+		nodes = append(nodes, x)
+		x = x.next(spec.rev)
+	}
+	return nodes
+}
+
+// writeZrange writes the members of nodes, each followed by its score
+// withScores. RESP3 clients get member-score pairs.
+func writeZrange(w *r.Writer, nodes []*zskiplistNode, withScores bool) {
+	switch {
+	case !withScores:
+		w.WriteArrayHeader(len(nodes))
+		for _, node := range nodes {
+			w.WriteBulkString(node.member)
+		}
+	case w.Protocol == r.RESP3:
+		w.WriteArrayHeader(len(nodes))
+		for _, node := range nodes {
+			w.WriteArrayHeader(2)
+			w.WriteBulkString(node.member)
+			w.WriteDouble(node.score)
+		}
+	default:
+		w.WriteArrayHeader(2 * len(nodes))
+		for _, node := range nodes {
+			w.WriteBulkString(node.member)
+			w.WriteDouble(node.score)
+		}
+	}
+}
+
+// https://redis.io/commands/zadd/
+func HandleZADD(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+
+	nx, xx, gt, lt, ch, incr := false, false, false, false, false, false
+	i := 2
+options:
+	for ; i < len(contents); i++ {
+		switch strings.ToUpper(contents[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := contents[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		w.WriteError(errSyntax)
+		return
+	}
+	if nx && xx {
+		w.WriteError(errors.New("XX and NX options at the same time are not compatible"))
+		return
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		w.WriteError(errors.New("GT, LT, and/or NX options at the same time are not compatible"))
+		return
+	}
+	if incr && len(pairs) > 2 {
+		w.WriteError(errors.New("INCR option supports a single increment-element pair"))
+		return
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, err := parseScore(pairs[2*j])
+		if err != nil {
+			w.WriteError(err)
+			return
+		}
+		scores[j] = score
+	}
+
+	z, exists, err := loadZset(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists && !xx {
+		z = newZset()
+		db.Store(key, z)
+	}
+
+	added, updated := 0, 0
+	// the score INCR replies with, unless the member was left alone
+	incrScore, incremented := 0.0, false
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		current, ok := z.Score(member)
+		if !ok {
+			if xx {
+				continue
+			}
+			z.Add(member, score)
+			added++
+			incrScore, incremented = score, true
+			continue
+		}
+
+		if nx {
+			continue
+		}
+		newScore := score
+		if incr {
+			newScore += current
+			if math.IsNaN(newScore) {
+				w.WriteError(errScoreNaN)
+				return
+			}
+		}
+		if (lt && newScore >= current) || (gt && newScore <= current) {
+			continue
+		}
+		if newScore != current {
+			z.Add(member, newScore)
+			updated++
+		}
+		incrScore, incremented = newScore, true
+	}
+
+	if added > 0 {
+		signalKeyAsReady(key)
+	}
+
+	switch {
+	case incr && !incremented:
+		w.WriteNull()
+	case incr:
+		w.WriteDouble(incrScore)
+	case ch:
+		w.WriteInteger(int64(added + updated))
+	default:
+		w.WriteInteger(int64(added))
+	}
+}
+
+// https://redis.io/commands/zincrby/
+func HandleZINCRBY(client *Client, w *r.Writer, contents []string) {
+	key, member := contents[1], contents[3]
+	increment, err := parseScore(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	z, exists, err := loadZset(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	current, _ := z.Score(member)
+	score := current + increment
+	if math.IsNaN(score) {
+		w.WriteError(errScoreNaN)
+		return
+	}
+	if !exists {
+		z = newZset()
+		db.Store(key, z)
+	}
+	z.Add(member, score)
+	signalKeyAsReady(key)
+	w.WriteDouble(score)
+}
+
+// https://redis.io/commands/zrem/
+func HandleZREM(client *Client, w *r.Writer, contents []string) {
+	key := contents[1]
+	z, exists, err := loadZset(key)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteInteger(0)
+		return
+	}
+
+	removed := 0
+	for _, member := range contents[2:] {
+		if z.Remove(member) {
+			removed++
+		}
+	}
+	// a sorted set left without members is deleted
+	if z.Len() == 0 {
+		db.LoadAndDelete(key)
+	}
+	w.WriteInteger(int64(removed))
+}
+
+// https://redis.io/commands/zscore/
+func HandleZSCORE(client *Client, w *r.Writer, contents []string) {
+	z, _, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	score, ok := z.Score(contents[2])
+	if !ok {
+		w.WriteNull()
+		return
+	}
+	w.WriteDouble(score)
+}
+
+// https://redis.io/commands/zmscore/
+func HandleZMSCORE(client *Client, w *r.Writer, contents []string) {
+	z, _, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	members := contents[2:]
+	w.WriteArrayHeader(len(members))
+	for _, member := range members {
+		if score, ok := z.Score(member); ok {
+			w.WriteDouble(score)
+		} else {
+			w.WriteNull()
+		}
+	}
+}
+
+// https://redis.io/commands/zcard/
+func HandleZCARD(client *Client, w *r.Writer, contents []string) {
+	z, _, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	w.WriteInteger(int64(z.Len()))
+}
+
+// https://redis.io/commands/zcount/
+func HandleZCOUNT(client *Client, w *r.Writer, contents []string) {
+	sr, err := parseScoreRange(contents[2], contents[3])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	z, exists, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteInteger(0)
+		return
+	}
+
+	// the count is the difference of the ranks of the ends of the range
+	first := z.zsl.First(func(n *zskiplistNode) bool { return sr.aboveMin(n.score) })
+	if first == nil || !sr.belowMax(first.score) {
+		w.WriteInteger(0)
+		return
+	}
+	last := z.zsl.Last(func(n *zskiplistNode) bool { return sr.belowMax(n.score) })
+	count := z.zsl.Rank(last.score, last.member) - z.zsl.Rank(first.score, first.member) + 1
+	w.WriteInteger(int64(count))
+}
+
+// shared by ZRANK and ZREVRANK
+func rankGeneric(w *r.Writer, contents []string, reverse bool) {
+	withScore := false
+	if len(contents) == 4 {
+		if strings.ToUpper(contents[3]) != "WITHSCORE" {
+			w.WriteError(errSyntax)
+			return
+		}
+		withScore = true
+	} else if len(contents) > 4 {
+		w.WriteError(errSyntax)
+		return
+	}
+
+	z, _, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	rank, ok := z.Rank(contents[2], reverse)
+	if !ok {
+		if withScore {
+			w.WriteNullArray()
+		} else {
+			w.WriteNull()
+		}
+		return
+	}
+	if !withScore {
+		w.WriteInteger(int64(rank))
+		return
+	}
+	score, _ := z.Score(contents[2])
+	w.WriteArrayHeader(2)
+	w.WriteInteger(int64(rank))
+	w.WriteDouble(score)
+}
+
+// https://redis.io/commands/zrank/
+func HandleZRANK(client *Client, w *r.Writer, contents []string) {
+	rankGeneric(w, contents, false)
+}
+
+// https://redis.io/commands/zrevrank/
+func HandleZREVRANK(client *Client, w *r.Writer, contents []string) {
+	rankGeneric(w, contents, true)
+}
+
+// https://redis.io/commands/zrange/
+func HandleZRANGE(client *Client, w *r.Writer, contents []string) {
+	spec, err := parseZrange(contents[2:])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	z, _, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	writeZrange(w, zrange(z, spec), spec.withScores)
+}
+
+// loadScores returns the members of the sorted set stored at key mapped to
+// their scores, nil when it doesn't exist. The members of a set score 1.
+// It must not be modified.
+func loadScores(key string) (map[string]float64, error) {
+	value, ok := db.Load(key)
+	if !ok {
+		return nil, nil
+	}
+	switch value := value.(type) {
+	case *zset:
+		return value.dict, nil
+	case set:
+		scores := make(map[string]float64, len(value))
+		for member := range value {
+			scores[member] = 1
+		}
+		return scores, nil
+	}
+	return nil, errWrongType
+}
+
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// zsetOpSpec is a parsed ZUNION, ZINTER or ZDIFF query.
+type zsetOpSpec struct {
+	keys      []string
+	weights   []float64
+	aggregate int
+	// never set for the STORE variants
+	withScores bool
+}
+
+// parseZsetOp parses the numkeys key [key ...] [WEIGHTS weight [weight ...]]
+// [AGGREGATE SUM|MIN|MAX] [WITHSCORES] arguments of command. ZDIFF takes
+// neither WEIGHTS nor AGGREGATE, and the STORE variants no WITHSCORES.
+func parseZsetOp(args []string, command string, op setOp, store bool) (zsetOpSpec, error) {
+	spec := zsetOpSpec{}
+	numKeys, err := parseInteger(args[0])
+	if err != nil {
+		return spec, err
+	}
+	if numKeys <= 0 {
+		return spec, fmt.Errorf("at least 1 input key is needed for '%s' command", command)
+	}
+	if numKeys > int64(len(args)-1) {
+		return spec, errSyntax
+	}
+	spec.keys = args[1 : 1+numKeys]
+	spec.weights = make([]float64, numKeys)
+	for i := range spec.weights {
+		spec.weights[i] = 1
+	}
+
+	args = args[1+numKeys:]
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "WEIGHTS" && op != setDiff && i+len(spec.weights) < len(args):
+			for j := range spec.weights {
+				weight, err := strconv.ParseFloat(args[i+1+j], 64)
+				if err != nil || math.IsNaN(weight) {
+					return spec, errors.New("weight value is not a float")
+				}
+				spec.weights[j] = weight
+			}
+			i += len(spec.weights)
+		case option == "AGGREGATE" && op != setDiff && i+1 < len(args):
+			switch strings.ToUpper(args[i+1]) {
+			case "SUM":
+				spec.aggregate = aggregateSum
+			case "MIN":
+				spec.aggregate = aggregateMin
+			case "MAX":
+				spec.aggregate = aggregateMax
+			default:
+				return spec, errSyntax
+			}
+			i++
+		case option == "WITHSCORES" && !store:
+			spec.withScores = true
+		default:
+			return spec, errSyntax
+		}
+	}
+	return spec, nil
+}
+
+// aggregateScores combines the scores a member has in several sorted sets.
+func aggregateScores(aggregate int, a float64, b float64) float64 {
+	switch aggregate {
+	case aggregateMin:
+		return min(a, b)
+	case aggregateMax:
+		return max(a, b)
+	}
+	// +inf and -inf sum up to 0, not NaN
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// weightScore multiplies score by weight, 0 standing in for NaN (e.g.
+// 0 * inf).
+func weightScore(score float64, weight float64) float64 {
+	if weighted := score * weight; !math.IsNaN(weighted) {
+		return weighted
+	}
+	return 0
+}
+
+// zsetAlgebra returns the union, intersection or difference (of the first
+// sorted set and the others) of the sorted sets of spec.
+func zsetAlgebra(op setOp, spec zsetOpSpec) (*zset, error) {
+	inputs := make([]map[string]float64, len(spec.keys))
+	for i, key := range spec.keys {
+		scores, err := loadScores(key)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = scores
+	}
+
+	result := newZset()
+	switch op {
+	case setUnion:
+		scores := map[string]float64{}
+		for i, input := range inputs {
+			for member, score := range input {
+				score = weightScore(score, spec.weights[i])
+				if current, ok := scores[member]; ok {
+					score = aggregateScores(spec.aggregate, current, score)
+				}
+				scores[member] = score
+			}
+		}
+		for member, score := range scores {
+			result.Add(member, score)
+		}
+	case setInter:
+		// the smallest sorted set bounds the intersection
+		smallest := 0
+		for i, input := range inputs {
+			if len(input) < len(inputs[smallest]) {
+				smallest = i
+			}
+		}
+	members:
+		for member := range inputs[smallest] {
+			var score float64
+			for i, input := range inputs {
+				other, ok := input[member]
+				if !ok {
+					continue members
+				}
+				other = weightScore(other, spec.weights[i])
+				if i == 0 {
+					score = other
+				} else {
+					score = aggregateScores(spec.aggregate, score, other)
+				}
+			}
+			result.Add(member, score)
+		}
+	case setDiff:
+	diff:
+		for member, score := range inputs[0] {
+			for _, input := range inputs[1:] {
+				if _, ok := input[member]; ok {
+					continue diff
+				}
+			}
+			result.Add(member, score)
+		}
+	}
+	return result, nil
+}
+
+// storeZset stores z at destination, deleting it when z is empty, and
+// replies with its size.
+func storeZset(w *r.Writer, destination string, z *zset) {
+	if z.Len() == 0 {
+		db.LoadAndDelete(destination)
+	} else {
+		db.Store(destination, z)
+		signalKeyAsReady(destination)
+	}
+	w.WriteInteger(int64(z.Len()))
+}
+
+// shared by ZUNION, ZINTER and ZDIFF
+func zsetAlgebraGeneric(w *r.Writer, contents []string, op setOp) {
+	spec, err := parseZsetOp(contents[1:], strings.ToLower(contents[0]), op, false)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	result, err := zsetAlgebra(op, spec)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	writeZrange(w, zrange(result, zrangeSpec{start: 0, stop: -1}), spec.withScores)
+}
+
+// shared by ZUNIONSTORE, ZINTERSTORE and ZDIFFSTORE
+func zsetAlgebraStoreGeneric(w *r.Writer, contents []string, op setOp) {
+	spec, err := parseZsetOp(contents[2:], strings.ToLower(contents[0]), op, true)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	result, err := zsetAlgebra(op, spec)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	storeZset(w, contents[1], result)
+}
+
+// zsetStoreKeys finds the keys of ZUNIONSTORE, ZINTERSTORE and ZDIFFSTORE:
+// the destination, then the keys counted by numkeys.
+func zsetStoreKeys(args []string) []string {
+	return append([]string{args[1]}, mpopKeys(2)(args)...)
+}
+
+// https://redis.io/commands/zunion/
+func HandleZUNION(client *Client, w *r.Writer, contents []string) {
+	zsetAlgebraGeneric(w, contents, setUnion)
+}
+
+// https://redis.io/commands/zinter/
+func HandleZINTER(client *Client, w *r.Writer, contents []string) {
+	zsetAlgebraGeneric(w, contents, setInter)
+}
+
+// https://redis.io/commands/zdiff/
+func HandleZDIFF(client *Client, w *r.Writer, contents []string) {
+	zsetAlgebraGeneric(w, contents, setDiff)
+}
+
+// https://redis.io/commands/zunionstore/
+func HandleZUNIONSTORE(client *Client, w *r.Writer, contents []string) {
+	zsetAlgebraStoreGeneric(w, contents, setUnion)
+}
+
+// https://redis.io/commands/zinterstore/
+func HandleZINTERSTORE(client *Client, w *r.Writer, contents []string) {
+	zsetAlgebraStoreGeneric(w, contents, setInter)
+}
+
+// https://redis.io/commands/zdiffstore/
+func HandleZDIFFSTORE(client *Client, w *r.Writer, contents []string) {
+	zsetAlgebraStoreGeneric(w, contents, setDiff)
+}
+
+// https://redis.io/commands/zrangestore/
+func HandleZRANGESTORE(client *Client, w *r.Writer, contents []string) {
+	spec, err := parseZrange(contents[3:])
+	if err == nil && spec.withScores {
+		err = errSyntax
+	}
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	z, _, err := loadZset(contents[2])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	result := newZset()
+	for _, node := range zrange(z, spec) {
+		result.Add(node.member, node.score)
+	}
+	storeZset(w, contents[1], result)
+}
+
+// parseMinMax parses the MIN or MAX argument of ZMPOP and BZMPOP.
+func parseMinMax(arg string) (lowest bool, err error) {
+	switch strings.ToUpper(arg) {
+	case "MIN":
+		return true, nil
+	case "MAX":
+		return false, nil
+	}
+	return false, errSyntax
+}
+
+// zpop pops up to count members of the sorted set stored at key, the ones
+// with the lowest scores if lowest and the highest otherwise, and deletes
+// the key once it's empty.
+func zpop(key string, z *zset, lowest bool, count int64) []*zskiplistNode {
+	popped := make([]*zskiplistNode, 0, min(count, int64(z.Len())))
+	for int64(len(popped)) < count && z.Len() > 0 {
+		node := z.zsl.tail
+		if lowest {
+			node = z.zsl.header.level[0].forward
+		}
+		z.Remove(node.member)
+		popped = append(popped, node)
+	}
+	if z.Len() == 0 {
+		db.LoadAndDelete(key)
+	}
+	return popped
+}
+
+// shared by ZPOPMIN and ZPOPMAX
+func zpopGeneric(w *r.Writer, contents []string, lowest bool) {
+	if len(contents) > 3 {
+		w.WriteError(errSyntax)
+		return
+	}
+	withCount := len(contents) == 3
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = parseInteger(contents[2])
+		if err != nil || count < 0 {
+			w.WriteError(errNotPositive)
+			return
+		}
+	}
+
+	z, exists, err := loadZset(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	if !exists {
+		w.WriteArrayHeader(0)
+		return
+	}
+	popped := zpop(contents[1], z, lowest, count)
+	// a single member isn't nested in a pair, even for RESP3 clients
+	if !withCount {
+		w.WriteArrayHeader(2)
+		w.WriteBulkString(popped[0].member)
+		w.WriteDouble(popped[0].score)
+		return
+	}
+	writeZrange(w, popped, true)
+}
+
+// https://redis.io/commands/zpopmin/
+func HandleZPOPMIN(client *Client, w *r.Writer, contents []string) {
+	zpopGeneric(w, contents, true)
+}
+
+// https://redis.io/commands/zpopmax/
+func HandleZPOPMAX(client *Client, w *r.Writer, contents []string) {
+	zpopGeneric(w, contents, false)
+}
+
+// zpopMany pops up to count members of the sorted set stored at key for
+// ZMPOP and BZMPOP, replying with the key and the member-score pairs. It
+// returns false, without replying, when key doesn't exist.
+func zpopMany(w *r.Writer, key string, lowest bool, count int64) bool {
+	z, exists, err := loadZset(key)
+	if err != nil {
+		w.WriteError(err)
+		return true
+	}
+	if !exists {
+		return false
+	}
+
+	popped := zpop(key, z, lowest, count)
+	w.WriteArrayHeader(2)
+	w.WriteBulkString(key)
+	w.WriteArrayHeader(len(popped))
+	for _, node := range popped {
+		w.WriteArrayHeader(2)
+		w.WriteBulkString(node.member)
+		w.WriteDouble(node.score)
+	}
+	return true
+}
+
+// https://redis.io/commands/zmpop/
+func HandleZMPOP(client *Client, w *r.Writer, contents []string) {
+	keys, lowest, count, err := parseMPop(contents[1:], parseMinMax)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	for _, key := range keys {
+		if zpopMany(w, key, lowest, count) {
+			return
+		}
+	}
+	w.WriteNullArray()
+}
+
+// blockingZpopGeneric implements BZPOPMIN and BZPOPMAX, popping the member
+// with the lowest score if lowest and the highest otherwise.
+func blockingZpopGeneric(client *Client, w *r.Writer, contents []string, lowest bool) {
+	keys := contents[1 : len(contents)-1]
+	timeout, err := parseTimeout(contents[len(contents)-1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	serve := func(w *r.Writer, key string) bool {
+		z, exists, err := loadZset(key)
+		if err != nil {
+			w.WriteError(err)
+			return true
+		}
+		if !exists {
+			return false
+		}
+		node := zpop(key, z, lowest, 1)[0]
+		w.WriteArrayHeader(3)
+		w.WriteBulkString(key)
+		w.WriteBulkString(node.member)
+		w.WriteDouble(node.score)
+		return true
+	}
+	for _, key := range keys {
+		if serve(w, key) {
+			return
+		}
+	}
+	blockClient(client, w, keys, isZset, timeout, serve, (*r.Writer).WriteNullArray)
+}
+
+// https://redis.io/commands/bzpopmin/
+func HandleBZPOPMIN(client *Client, w *r.Writer, contents []string) {
+	blockingZpopGeneric(client, w, contents, true)
+}
+
+// https://redis.io/commands/bzpopmax/
+func HandleBZPOPMAX(client *Client, w *r.Writer, contents []string) {
+	blockingZpopGeneric(client, w, contents, false)
+}
+
+// https://redis.io/commands/bzmpop/
+func HandleBZMPOP(client *Client, w *r.Writer, contents []string) {
+	timeout, err := parseTimeout(contents[1])
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+	keys, lowest, count, err := parseMPop(contents[2:], parseMinMax)
+	if err != nil {
+		w.WriteError(err)
+		return
+	}
+
+	serve := func(w *r.Writer, key string) bool {
+		return zpopMany(w, key, lowest, count)
+	}
+	for _, key := range keys {
+		if serve(w, key) {
+			return
+		}
+	}
+	blockClient(client, w, keys, isZset, timeout, serve, (*r.Writer).WriteNullArray)
+}
@@ -0,0 +1,119 @@
+package utils
+
+// hash is the value of hash keys, a map of fields to their values in which
+// every field may carry an expiration time.
+// https://redis.io/docs/data-types/hashes/
+type hash struct {
+	fields map[string]string
+	// unix time in milliseconds of the fields with an expiration time
+	expires map[string]int64
+	// no field expires before this time, 0 when none has an expiration time
+	nextExpire int64
+}
+
+func newHash() *hash {
+	return &hash{fields: map[string]string{}}
+}
+
+// Len returns the number of fields, nil-safe.
+func (h *hash) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// Get returns the value of field, nil-safe.
+func (h *hash) Get(field string) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// Fields returns the fields mapped to their values, nil-safe. It must not be
+// modified.
+func (h *hash) Fields() map[string]string {
+	if h == nil {
+		return nil
+	}
+	return h.fields
+}
+
+// Set sets field to value, discarding any expiration time it had, and
+// returns whether the field was added.
+func (h *hash) Set(field string, value string) bool {
+	_, exists := h.fields[field]
+	h.fields[field] = value
+	delete(h.expires, field)
+	return !exists
+}
+
+// Update sets field to value, keeping its expiration time, the way commands
+// that modify a value (e.g. HINCRBY) do.
+func (h *hash) Update(field string, value string) {
+	h.fields[field] = value
+}
+
+// Delete removes field, returning whether it existed.
+func (h *hash) Delete(field string) bool {
+	if _, ok := h.fields[field]; !ok {
+		return false
+	}
+	delete(h.fields, field)
+	delete(h.expires, field)
+	return true
+}
+
+// ExpireAt returns the expiration time of field (unix time in milliseconds,
+// 0 when it never expires).
+func (h *hash) ExpireAt(field string) int64 {
+	return h.expires[field]
+}
+
+// Expire sets the expiration time of an existing field.
+func (h *hash) Expire(field string, expireAt int64) {
+	if h.expires == nil {
+		h.expires = map[string]int64{}
+	}
+	h.expires[field] = expireAt
+	if h.nextExpire == 0 || expireAt < h.nextExpire {
+		h.nextExpire = expireAt
+	}
+}
+
+// Persist removes the expiration time of field, returning whether it had one.
+func (h *hash) Persist(field string) bool {
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+	delete(h.expires, field)
+	return true
+}
+
+// Volatile returns whether some field has an expiration time.
+func (h *hash) Volatile() bool {
+	return len(h.expires) > 0
+}
+
+// reclaim deletes the fields that expired by now (unix time in
+// milliseconds), and returns how many it deleted. Nothing is looked at
+// until the earliest expiration time passed.
+func (h *hash) reclaim(now int64) int {
+	if h.nextExpire == 0 || h.nextExpire > now {
+		return 0
+	}
+	deleted := 0
+	h.nextExpire = 0
+	for field, expireAt := range h.expires {
+		if expireAt <= now {
+			delete(h.fields, field)
+			delete(h.expires, field)
+			deleted++
+		} else if h.nextExpire == 0 || expireAt < h.nextExpire {
+			h.nextExpire = expireAt
+		}
+	}
+	return deleted
+}
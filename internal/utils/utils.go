@@ -1,180 +1,91 @@
 package utils
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
-	"os"
-	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/C41M50N/Redis-Server-Lite/internal/r"
 )
 
-func ProcessClient(conn net.Conn) {
-	defer conn.Close()
-
-	for {
-		buffer := make([]byte, 1024)
-		messageLen, err := conn.Read(buffer)
-		if err != nil && messageLen == 0 {
-			conn.Close()
-			break
-		}
-		var bufferStr string = string(buffer[:messageLen])
-		fmt.Printf("Received (%d): %s\n", messageLen, strings.ReplaceAll(bufferStr, "\r\n", "\\r\\n"))
-
-		// handle redis-benchmark CONFIG request
-		if bufferStr == "*3\r\n$6\r\nCONFIG\r\n$3\r\nGET\r\n$4\r\nsave\r\n*3\r\n$6\r\nCONFIG\r\n$3\r\nGET\r\n$10\r\nappendonly\r\n" {
-			fmt.Println("CONFIG BS 4 redis-benchmark...")
-			break
-		}
-
-		messageContents, err := parseRESPMessage(buffer)
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-		}
-
-		var output []byte
-
-		switch strings.ToUpper(messageContents[0]) {
-		case "PING":
-			res, err := HandlePING(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToBulkString(res)
-			}
-
-		case "ECHO":
-			res, err := HandleECHO(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToBulkString(res)
-			}
+const (
+	// the version reported to clients by HELLO
+	serverVersion = "7.2.0"
+	// the size pipelined replies are sent at without waiting for the rest
+	maxPendingReplies = 64 * 1024
+)
 
-		case "GET":
-			res, err := HandleGET(messageContents)
-			if err != nil {
-				if err.Error() == "NULL" {
-					output = r.ToNull()
-				} else {
-					output = r.ToSimpleError(err.Error())
-				}
-			} else {
-				output = r.ToBulkString(res)
-			}
+var lastClientID atomic.Int64
+
+// Client holds the state of a single connection.
+type Client struct {
+	ID   int64
+	Name string
+	// set by a blocking command that has to wait
+	blocked *blockedClient
+	// reports the error, if any, of the goroutine that watched the
+	// connection while the client was blocked
+	watcher chan error
+}
 
-		case "SET":
-			res, err := HandleSET(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToSimpleString(res)
-			}
+func ProcessClient(conn net.Conn) {
+	defer conn.Close()
 
-		case "EXISTS":
-			res, err := HandleEXISTS(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToInteger(res)
-			}
+	client := &Client{ID: lastClientID.Add(1)}
 
-		case "DEL":
-			res, err := HandleDEL(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToInteger(res)
-			}
+	reader := r.NewReader(conn)
+	writer := r.NewWriter(conn)
+	defer writer.Flush()
 
-		case "INCR":
-			res, err := HandleINCR(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToInteger(res)
+	for {
+		// the connection is read again once the watcher a blocked client left
+		// behind is done with it, the reply it waited for goes out first
+		if client.watcher != nil {
+			if err := writer.Flush(); err != nil {
+				break
 			}
-
-		case "DECR":
-			res, err := HandleDECR(messageContents)
+			err := <-client.watcher
+			client.watcher = nil
 			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToInteger(res)
+				break
 			}
+		}
 
-		case "LPUSH":
-			res, err := HandleLPUSH(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToInteger(res)
+		// pipelined commands are answered together, before waiting for more
+		// of them to arrive or once their replies grow large
+		if !reader.HasCommand() || len(writer.Buffered()) >= maxPendingReplies {
+			if err := writer.Flush(); err != nil {
+				break
 			}
+		}
 
-		case "RPUSH":
-			res, err := HandleRPUSH(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToInteger(res)
+		messageContents, err := reader.ReadCommand()
+		if err != nil {
+			var protocolErr *r.ProtocolError
+			if errors.As(err, &protocolErr) {
+				// the rest of the stream can't be trusted, reply and hang up
+				fmt.Println(err.Error())
+				writer.WriteError(err)
 			}
-
-		case "LRANGE":
-			res, err := HandleLRANGE(messageContents)
-			if err != nil {
-				output = r.ToSimpleError(err.Error())
-			} else {
-				output = r.ToArray(res)
+			break
+		}
+		var fancyArrayString, _ = json.Marshal(messageContents)
+		fmt.Printf("Received (%d): %s\n", len(messageContents), fancyArrayString)
+
+		start := len(writer.Buffered())
+		Execute(client, writer, messageContents)
+		if client.blocked != nil {
+			// the replies written before were sent
+			start = 0
+			if !waitUnblocked(client, writer, reader) {
+				break
 			}
-
-		default:
-			output = r.ToSimpleError(fmt.Sprintf("unknown command '%s'", messageContents[0]))
 		}
 
+		output := writer.Buffered()[start:]
 		fmt.Printf("Sending: %s\n", strings.ReplaceAll(string(output), "\r\n", "\\r\\n"))
-		conn.Write(output)
-	}
-}
-
-func parseRESPMessage(buffer []byte) ([]string, error) {
-	var res []string
-	switch buffer[0] {
-	case byte('*'): // array
-		var arrayLen uint64
-
-		var contents = bytes.SplitN(buffer, []byte("\r\n"), 2)
-
-		var arrayLenBytes []byte = (contents[0])[1:]
-		arrayLen, _ = strconv.ParseUint(string(arrayLenBytes), 10, 64)
-
-		var rawArrayBytes = bytes.Split(contents[1], []byte("\r\n"))
-		var arrayBytes = make([][]byte, 0)
-		for i := 0; i < int(arrayLen); i++ {
-			arrayBytes = append(arrayBytes, rawArrayBytes[(2*i)+1])
-		}
-
-		var arrayStrings []string
-		for _, byteArray := range arrayBytes {
-			arrayStrings = append(arrayStrings, string(byteArray))
-		}
-		var fancyArrayString, _ = json.Marshal(arrayStrings)
-
-		fmt.Printf("Type: Array; Size: %d; Contents: %v\n", arrayLen, string(fancyArrayString))
-
-		res = arrayStrings
-
-	default:
-		fmt.Println("recieved unsupported message type")
-	}
-
-	if res != nil {
-		return res, nil
-	} else {
-		return make([]string, 0), fmt.Errorf("unsupported message type")
 	}
 }
@@ -0,0 +1,299 @@
+package utils
+
+import "math/rand"
+
+// The skiplist of sorted sets, ported from redis.
+// https://github.com/redis/redis/blob/7.2/src/t_zset.c
+const (
+	zskiplistMaxLevel = 32
+	// the probability for a node to have one more level
+	zskiplistP = 0.25
+)
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	// the number of nodes forward skips over, which makes ranks O(log n)
+	span int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+// less returns whether n sorts before score and member: by score, then
+// member.
+func (n *zskiplistNode) less(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// zskiplist orders the members of a sorted set, with O(log n) inserts,
+// deletes and lookups by rank.
+type zskiplist struct {
+	header *zskiplistNode
+	tail   *zskiplistNode
+	length int
+	level  int
+}
+
+func newZskiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{level: make([]zskiplistLevel, zskiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < zskiplistMaxLevel && rand.Float64() < zskiplistP {
+		level++
+	}
+	return level
+}
+
+// Insert adds member with score, which must not be in the list yet.
+func (zsl *zskiplist) Insert(score float64, member string) *zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	// the rank of update[i]
+	var rank [zskiplistMaxLevel]int
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i != zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+	x = &zskiplistNode{member: member, score: score, level: make([]zskiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	// the levels above the new node skip over one more node
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// search returns the last node of every level sorting before score and
+// member.
+func (zsl *zskiplist) search(score float64, member string) [zskiplistMaxLevel]*zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// unlink removes x, update being the result of search.
+func (zsl *zskiplist) unlink(x *zskiplistNode, update [zskiplistMaxLevel]*zskiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// Delete removes member with score, returning whether it was found.
+func (zsl *zskiplist) Delete(score float64, member string) bool {
+	update := zsl.search(score, member)
+	x := update[0].level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+	zsl.unlink(x, update)
+	return true
+}
+
+// UpdateScore moves member from score to newScore. The node is updated in
+// place when it keeps its position.
+func (zsl *zskiplist) UpdateScore(score float64, member string, newScore float64) {
+	update := zsl.search(score, member)
+	x := update[0].level[0].forward
+	if (x.backward == nil || x.backward.score < newScore) &&
+		(x.level[0].forward == nil || x.level[0].forward.score > newScore) {
+		x.score = newScore
+		return
+	}
+	zsl.unlink(x, update)
+	zsl.Insert(newScore, member)
+}
+
+// Rank returns the 0-based rank of member with score, or -1 when it isn't
+// in the list.
+func (zsl *zskiplist) Rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.less(score, member) || (x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.member == member {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// ByRank returns the node at the 0-based rank, or nil when it's out of
+// range.
+func (zsl *zskiplist) ByRank(rank int) *zskiplistNode {
+	// spans count from 1
+	rank++
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// First returns the first node for which inRange holds, inRange being
+// false for the nodes before some point and true after. nil is returned
+// when it holds for none.
+func (zsl *zskiplist) First(inRange func(n *zskiplistNode) bool) *zskiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !inRange(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	return x.level[0].forward
+}
+
+// Last returns the last node for which inRange holds, inRange being true
+// for the nodes before some point and false after. nil is returned when it
+// holds for none.
+func (zsl *zskiplist) Last(inRange func(n *zskiplistNode) bool) *zskiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && inRange(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	if x == zsl.header {
+		return nil
+	}
+	return x
+}
+
+// zset is the value of sorted set keys: unique members ordered by their
+// score. The dictionary finds the score of a member in O(1), the skiplist
+// orders them.
+// https://redis.io/docs/data-types/sorted-sets/
+type zset struct {
+	dict map[string]float64
+	zsl  *zskiplist
+}
+
+func newZset() *zset {
+	return &zset{dict: map[string]float64{}, zsl: newZskiplist()}
+}
+
+// Len returns the number of members, nil-safe.
+func (z *zset) Len() int {
+	if z == nil {
+		return 0
+	}
+	return len(z.dict)
+}
+
+// Score returns the score of member, nil-safe.
+func (z *zset) Score(member string) (float64, bool) {
+	if z == nil {
+		return 0, false
+	}
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add sets the score of member, returning whether it was added.
+func (z *zset) Add(member string, score float64) bool {
+	current, exists := z.dict[member]
+	if !exists {
+		z.zsl.Insert(score, member)
+		z.dict[member] = score
+		return true
+	}
+	if current != score {
+		z.zsl.UpdateScore(current, member, score)
+		z.dict[member] = score
+	}
+	return false
+}
+
+// Remove deletes member, returning whether it existed.
+func (z *zset) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.Delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank returns the 0-based rank of member, from the highest score when
+// reverse, and whether it exists. It is nil-safe.
+func (z *zset) Rank(member string, reverse bool) (int, bool) {
+	score, ok := z.Score(member)
+	if !ok {
+		return 0, false
+	}
+	rank := z.zsl.Rank(score, member)
+	if reverse {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, true
+}
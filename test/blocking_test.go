@@ -0,0 +1,299 @@
+package test
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+	"github.com/stretchr/testify/assert"
+)
+
+// long enough for a command sent by another client to block
+const blockDelay = 50 * time.Millisecond
+
+// sends a blocking command and waits for it to block
+func block(client net.Conn, args ...string) {
+	client.Write(r.ToArray(args))
+	time.Sleep(blockDelay)
+}
+
+func TestBLPOP1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "list1", "a", "b", "c"}, r.ToInteger(3)},
+		// the first non empty list is popped without blocking
+		{[]string{"BLPOP", "missing", "list1", "list2", "0"}, r.ToArray([]string{"list1", "a"})},
+		{[]string{"BRPOP", "missing", "list1", "0"}, r.ToArray([]string{"list1", "c"})},
+		{[]string{"BLPOP", "list1", "0"}, r.ToArray([]string{"list1", "b"})},
+		{[]string{"EXISTS", "list1"}, r.ToInteger(0)},
+		{[]string{"BLPOP", "list1", "0.1"}, r.ToNullArray()},
+		{[]string{"BRPOP", "list1", "0.1"}, r.ToNullArray()},
+		// a timeout below a nanosecond still times out
+		{[]string{"BLPOP", "list1", "0.0000000001"}, r.ToNullArray()},
+		{[]string{"BLPOP", "list1", "-1"}, r.ToSimpleError("ERR timeout is negative")},
+		{[]string{"BLPOP", "list1", "soon"}, r.ToSimpleError("ERR timeout is not a float or out of range")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"BLPOP", "string", "0"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestBLPOP2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+	blocked := connect()
+	defer blocked.Close()
+
+	block(blocked, "BLPOP", "queue1", "queue2", "0")
+
+	// the blocked client doesn't stop others from running commands
+	client.Write(r.ToArray([]string{"SET", "key", "value"}))
+	assert.Equal(t, r.ToSimpleString("OK"), readBuffer(client))
+
+	client.Write(r.ToArray([]string{"RPUSH", "queue2", "job"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	assert.Equal(t, r.ToArray([]string{"queue2", "job"}), readBuffer(blocked))
+
+	// the element went to the blocked client
+	client.Write(r.ToArray([]string{"EXISTS", "queue2"}))
+	assert.Equal(t, r.ToInteger(0), readBuffer(client))
+
+	// the client keeps working once unblocked
+	blocked.Write(r.ToArray([]string{"GET", "key"}))
+	assert.Equal(t, r.ToBulkString("value"), readBuffer(blocked))
+}
+
+func TestBLPOP3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// clients are served in the order they blocked
+	var waiting []net.Conn
+	for i := 0; i < 3; i++ {
+		blocked := connect()
+		defer blocked.Close()
+		block(blocked, "BRPOP", "queue", "0")
+		waiting = append(waiting, blocked)
+	}
+
+	client.Write(r.ToArray([]string{"RPUSH", "queue", "a", "b", "c", "d"}))
+	assert.Equal(t, r.ToInteger(4), readBuffer(client))
+
+	assert.Equal(t, r.ToArray([]string{"queue", "d"}), readBuffer(waiting[0]))
+	assert.Equal(t, r.ToArray([]string{"queue", "c"}), readBuffer(waiting[1]))
+	assert.Equal(t, r.ToArray([]string{"queue", "b"}), readBuffer(waiting[2]))
+
+	client.Write(r.ToArray([]string{"LRANGE", "queue", "0", "-1"}))
+	assert.Equal(t, r.ToArray([]string{"a"}), readBuffer(client))
+}
+
+func TestBLPOP4(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// a client that disconnects while blocked is never served
+	blocked := connect()
+	block(blocked, "BLPOP", "queue", "0")
+	blocked.Close()
+	time.Sleep(blockDelay)
+
+	client.Write(r.ToArray([]string{"RPUSH", "queue", "job"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"LLEN", "queue"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+}
+
+func TestBLPOP5(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+	blocked := connect()
+	defer blocked.Close()
+
+	// the timeout replies with a null array, and the client is no longer
+	// waiting afterwards
+	start := time.Now()
+	blocked.Write(r.ToArray([]string{"BLPOP", "queue", "0.2"}))
+	assert.Equal(t, r.ToNullArray(), readBuffer(blocked))
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	client.Write(r.ToArray([]string{"RPUSH", "queue", "job"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"LLEN", "queue"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+}
+
+func TestBLPOP6(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+	blocked := connect()
+	defer blocked.Close()
+
+	// commands pipelined after a blocking command wait for it, the ones
+	// before are answered right away
+	message := append(r.ToArray([]string{"PING"}), r.ToArray([]string{"BLPOP", "queue", "0"})...)
+	message = append(message, r.ToArray([]string{"ECHO", "after"})...)
+	go blocked.Write(message)
+	assert.Equal(t, r.ToBulkString("PONG"), readBuffer(blocked))
+	time.Sleep(blockDelay)
+
+	client.Write(r.ToArray([]string{"RPUSH", "queue", "job"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+
+	expected := append(r.ToArray([]string{"queue", "job"}), r.ToBulkString("after")...)
+	assert.Equal(t, expected, readBytes(blocked, len(expected)))
+}
+
+func TestBLMOVE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "source", "a", "b"}, r.ToInteger(2)},
+		{[]string{"BLMOVE", "source", "destination", "RIGHT", "LEFT", "0"}, r.ToBulkString("b")},
+		{[]string{"BLMOVE", "source", "destination", "LEFT", "LEFT", "0"}, r.ToBulkString("a")},
+		{[]string{"LRANGE", "destination", "0", "-1"}, r.ToArray([]string{"a", "b"})},
+		{[]string{"BLMOVE", "source", "destination", "LEFT", "LEFT", "0.1"}, r.ToNullBulkString()},
+		{[]string{"BLMOVE", "source", "destination", "UP", "LEFT", "0"}, r.ToSimpleError("ERR syntax error")},
+	})
+
+	// a blocked move feeds the clients blocked on its destination
+	mover := connect()
+	defer mover.Close()
+	block(mover, "BLMOVE", "pending", "processing", "LEFT", "RIGHT", "0")
+	popper := connect()
+	defer popper.Close()
+	block(popper, "BLPOP", "processing", "0")
+
+	client.Write(r.ToArray([]string{"RPUSH", "pending", "job"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	assert.Equal(t, r.ToBulkString("job"), readBuffer(mover))
+	assert.Equal(t, r.ToArray([]string{"processing", "job"}), readBuffer(popper))
+}
+
+func TestBLMPOP(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "list2", "a", "b", "c"}, r.ToInteger(3)},
+		{[]string{"BLMPOP", "0", "2", "list1", "list2", "LEFT"}, []byte("*2\r\n$5\r\nlist2\r\n*1\r\n$1\r\na\r\n")},
+		{[]string{"BLMPOP", "0", "2", "list1", "list2", "RIGHT", "COUNT", "5"}, []byte("*2\r\n$5\r\nlist2\r\n*2\r\n$1\r\nc\r\n$1\r\nb\r\n")},
+		{[]string{"BLMPOP", "0.1", "2", "list1", "list2", "LEFT"}, r.ToNullArray()},
+		{[]string{"BLMPOP", "0", "0", "list1", "LEFT"}, r.ToSimpleError("ERR numkeys should be greater than 0")},
+		{[]string{"BLMPOP", "0", "3", "list1", "LEFT"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"BLMPOP", "0", "1", "list1", "LEFT", "COUNT", "0"}, r.ToSimpleError("ERR count should be greater than 0")},
+		{[]string{"BLMPOP", "0", "1", "list1", "LEFT", "COUNT"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"COMMAND", "GETKEYS", "BLMPOP", "0", "2", "list1", "list2", "LEFT"}, r.ToArray([]string{"list1", "list2"})},
+	})
+
+	blocked := connect()
+	defer blocked.Close()
+	block(blocked, "BLMPOP", "0", "2", "list1", "list2", "LEFT", "COUNT", "2")
+	client.Write(r.ToArray([]string{"RPUSH", "list2", "x", "y", "z"}))
+	assert.Equal(t, r.ToInteger(3), readBuffer(client))
+	assert.Equal(t, []byte("*2\r\n$5\r\nlist2\r\n*2\r\n$1\r\nx\r\n$1\r\ny\r\n"), readBuffer(blocked))
+}
+
+func TestConcurrentBLPOP(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// every pushed job is popped by exactly one worker
+	const jobs = 200
+	go func() {
+		for i := 0; i < jobs; i++ {
+			client.Write(r.ToArray([]string{"RPUSH", "jobs", strconv.Itoa(i)}))
+			readBuffer(client)
+		}
+	}()
+
+	// workers stop once no job came for a while
+	var mu sync.Mutex
+	popped := map[string]int{}
+	concurrently(func(id int, worker net.Conn) {
+		for {
+			worker.Write(r.ToArray([]string{"BLPOP", "jobs", "0.5"}))
+			response := readBuffer(worker)
+			if string(response) == string(r.ToNullArray()) {
+				return
+			}
+			mu.Lock()
+			popped[string(response)]++
+			mu.Unlock()
+		}
+	})
+
+	assert.Len(t, popped, jobs)
+	for _, count := range popped {
+		assert.Equal(t, 1, count)
+	}
+}
+
+func TestBZPOPMIN(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "zset1", "0", "a", "1", "b", "2", "c"}, r.ToInteger(3)},
+		{[]string{"BZPOPMIN", "missing", "zset1", "0"}, r.ToArray([]string{"zset1", "a", "0"})},
+		{[]string{"BZPOPMAX", "missing", "zset1", "0"}, r.ToArray([]string{"zset1", "c", "2"})},
+		{[]string{"BZMPOP", "0", "2", "missing", "zset1", "MIN", "COUNT", "5"}, []byte("*2\r\n$5\r\nzset1\r\n*1\r\n*2\r\n$1\r\nb\r\n$1\r\n1\r\n")},
+		{[]string{"EXISTS", "zset1"}, r.ToInteger(0)},
+		{[]string{"BZPOPMIN", "zset1", "0.1"}, r.ToNullArray()},
+		{[]string{"BZMPOP", "0.1", "1", "zset1", "MAX"}, r.ToNullArray()},
+		{[]string{"BZPOPMIN", "zset1", "-1"}, r.ToSimpleError("ERR timeout is negative")},
+		{[]string{"BZMPOP", "0", "1", "zset1", "LEFT"}, r.ToSimpleError("ERR syntax error")},
+	})
+
+	// a ZADD wakes the client blocked the longest, with the member matching
+	// its command
+	minimum := connect()
+	defer minimum.Close()
+	block(minimum, "BZPOPMIN", "leaderboard", "0")
+	maximum := connect()
+	defer maximum.Close()
+	block(maximum, "BZPOPMAX", "leaderboard", "0")
+
+	client.Write(r.ToArray([]string{"ZADD", "leaderboard", "10", "alice", "20", "bob", "30", "carol"}))
+	assert.Equal(t, r.ToInteger(3), readBuffer(client))
+	assert.Equal(t, r.ToArray([]string{"leaderboard", "alice", "10"}), readBuffer(minimum))
+	assert.Equal(t, r.ToArray([]string{"leaderboard", "carol", "30"}), readBuffer(maximum))
+	client.Write(r.ToArray([]string{"ZRANGE", "leaderboard", "0", "-1"}))
+	assert.Equal(t, r.ToArray([]string{"bob"}), readBuffer(client))
+
+	// so do the commands storing a sorted set
+	blocked := connect()
+	defer blocked.Close()
+	block(blocked, "BZMPOP", "0", "1", "delayed", "MIN", "COUNT", "2")
+	client.Write(r.ToArray([]string{"ZUNIONSTORE", "delayed", "1", "leaderboard"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	assert.Equal(t, []byte("*2\r\n$7\r\ndelayed\r\n*1\r\n*2\r\n$3\r\nbob\r\n$2\r\n20\r\n"), readBuffer(blocked))
+}
+
+func TestBlockedWrongType(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// a key that gets another type than a client waits for leaves it
+	// blocked, and the clients waiting for that type are served
+	list := connect()
+	defer list.Close()
+	block(list, "BLPOP", "key", "0")
+	sorted := connect()
+	defer sorted.Close()
+	block(sorted, "BZPOPMIN", "key", "0")
+
+	client.Write(r.ToArray([]string{"ZADD", "key", "1", "member", "2", "other"}))
+	assert.Equal(t, r.ToInteger(2), readBuffer(client))
+	assert.Equal(t, r.ToArray([]string{"key", "member", "1"}), readBuffer(sorted))
+
+	client.Write(r.ToArray([]string{"DEL", "key"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"RPUSH", "key", "element"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	assert.Equal(t, r.ToArray([]string{"key", "element"}), readBuffer(list))
+}
@@ -2,8 +2,11 @@ package test
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +16,12 @@ import (
 )
 
 func createMockConnection() net.Conn {
+	utils.FlushDB()
+	return connect()
+}
+
+// connect opens another connection without flushing the store
+func connect() net.Conn {
 	server, client := net.Pipe()
 	go func() {
 		utils.ProcessClient(server)
@@ -31,6 +40,31 @@ func readBuffer(client net.Conn) []byte {
 	return buffer[:messageLen]
 }
 
+// reads exactly n bytes, for replies that don't fit in a single read
+func readBytes(client net.Conn, n int) []byte {
+	buffer := make([]byte, n)
+	messageLen, err := io.ReadFull(client, buffer)
+	if err != nil {
+		fmt.Printf("Issue Reading: %s\n", err.Error())
+	}
+	return buffer[:messageLen]
+}
+
+type testCase struct {
+	args     []string
+	expected []byte
+}
+
+// runCases sends the commands of cases in order, checking every reply
+func runCases(t *testing.T, client net.Conn, cases []testCase) {
+	t.Helper()
+	for _, c := range cases {
+		client.Write(r.ToArray(c.args))
+		response := readBuffer(client)
+		assert.Equal(t, c.expected, response, c.args)
+	}
+}
+
 func TestUnknownCommand(t *testing.T) {
 	client := createMockConnection()
 	defer client.Close()
@@ -40,7 +74,7 @@ func TestUnknownCommand(t *testing.T) {
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
 
-	assert.Equal(t, r.ToSimpleError("unknown command 'PEEK'"), response)
+	assert.Equal(t, r.ToSimpleError("ERR unknown command 'PEEK'"), response)
 }
 
 func TestPing1(t *testing.T) {
@@ -77,7 +111,7 @@ func TestPing3(t *testing.T) {
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
 
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'ping' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'ping' command"), response)
 }
 
 func TestEcho1(t *testing.T) {
@@ -102,7 +136,7 @@ func TestEcho2(t *testing.T) {
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
 
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'echo' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'echo' command"), response)
 }
 
 func TestStorage1(t *testing.T) {
@@ -151,7 +185,7 @@ func TestStorage3(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'set' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'set' command"), response)
 }
 
 func TestStorageEX1(t *testing.T) {
@@ -176,7 +210,7 @@ func TestStorageEX1(t *testing.T) {
 	time.Sleep(time.Duration(exp) * time.Second)
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToNull(), response)
+	assert.Equal(t, r.ToNullBulkString(), response)
 }
 
 func TestStorageEX2(t *testing.T) {
@@ -188,7 +222,7 @@ func TestStorageEX2(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 }
 
 func TestStorageEX3(t *testing.T) {
@@ -200,7 +234,7 @@ func TestStorageEX3(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("invalid expire time in 'set' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'set' command"), response)
 }
 
 func TestStoragePX1(t *testing.T) {
@@ -225,7 +259,7 @@ func TestStoragePX1(t *testing.T) {
 	time.Sleep(time.Duration(exp) * time.Millisecond)
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToNull(), response)
+	assert.Equal(t, r.ToNullBulkString(), response)
 }
 
 func TestStoragePX2(t *testing.T) {
@@ -237,7 +271,7 @@ func TestStoragePX2(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 }
 
 func TestStoragePX3(t *testing.T) {
@@ -249,7 +283,7 @@ func TestStoragePX3(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("invalid expire time in 'set' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'set' command"), response)
 }
 
 func TestStorageEXAT1(t *testing.T) {
@@ -274,7 +308,7 @@ func TestStorageEXAT1(t *testing.T) {
 	time.Sleep(time.Duration(exp-time.Now().Unix()) * time.Second)
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToNull(), response)
+	assert.Equal(t, r.ToNullBulkString(), response)
 }
 
 func TestStorageEXAT2(t *testing.T) {
@@ -286,7 +320,7 @@ func TestStorageEXAT2(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 }
 
 func TestStorageEXAT3(t *testing.T) {
@@ -298,7 +332,7 @@ func TestStorageEXAT3(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("invalid expire time in 'set' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'set' command"), response)
 }
 
 func TestStoragePXAT1(t *testing.T) {
@@ -323,7 +357,7 @@ func TestStoragePXAT1(t *testing.T) {
 	time.Sleep(time.Duration(exp-time.Now().UnixMilli()) * time.Millisecond)
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToNull(), response)
+	assert.Equal(t, r.ToNullBulkString(), response)
 }
 
 func TestStoragePXAT2(t *testing.T) {
@@ -335,7 +369,7 @@ func TestStoragePXAT2(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 }
 
 func TestStoragePXAT3(t *testing.T) {
@@ -347,7 +381,7 @@ func TestStoragePXAT3(t *testing.T) {
 
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("invalid expire time in 'set' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'set' command"), response)
 }
 
 func TestEXISTS1(t *testing.T) {
@@ -418,7 +452,7 @@ func TestEXISTS3(t *testing.T) {
 	args := []string{"EXISTS"}
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'EXISTS' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'exists' command"), response)
 }
 
 func TestDEL1(t *testing.T) {
@@ -455,7 +489,7 @@ func TestDEL2(t *testing.T) {
 	args := []string{"DEL"}
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'DEL' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'del' command"), response)
 }
 
 func TestINCR1(t *testing.T) {
@@ -495,7 +529,7 @@ func TestINCR2(t *testing.T) {
 	args = []string{"INCR", "salary"}
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 }
 
 func TestINCR3(t *testing.T) {
@@ -515,7 +549,7 @@ func TestINCR4(t *testing.T) {
 	args := []string{"INCR"}
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'INCR' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'incr' command"), response)
 }
 
 func TestDECR1(t *testing.T) {
@@ -555,7 +589,7 @@ func TestDECR2(t *testing.T) {
 	args = []string{"DECR", "salary"}
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 }
 
 func TestDECR3(t *testing.T) {
@@ -575,7 +609,7 @@ func TestDECR4(t *testing.T) {
 	args := []string{"DECR"}
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'DECR' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'decr' command"), response)
 }
 
 func TestLPUSH1(t *testing.T) {
@@ -617,7 +651,7 @@ func TestLPUSH3(t *testing.T) {
 	args := []string{"LPUSH", "rand-key"}
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'LPUSH' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'lpush' command"), response)
 }
 
 func TestRPUSH1(t *testing.T) {
@@ -659,7 +693,7 @@ func TestRPUSH3(t *testing.T) {
 	args := []string{"RPUSH", "rand-key"}
 	client.Write(r.ToArray(args))
 	response := readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'RPUSH' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'rpush' command"), response)
 }
 
 func TestLRANGE(t *testing.T) {
@@ -773,10 +807,1926 @@ func TestLRANGE3(t *testing.T) {
 	args = []string{"LRANGE", "key", "0", "INFINITY"}
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("value is not an integer or out of range"), response)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
 
 	args = []string{"LRANGE", "key"}
 	client.Write(r.ToArray(args))
 	response = readBuffer(client)
-	assert.Equal(t, r.ToSimpleError("wrong number of arguments for 'LRANGE' command"), response)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'lrange' command"), response)
+}
+
+func TestCOMMAND1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"COMMAND", "INFO", "get", "nosuchcommand"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	expected := "*2\r\n" +
+		"*10\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n*0\r\n*0\r\n*0\r\n*0\r\n" +
+		"*-1\r\n"
+	assert.Equal(t, []byte(expected), response)
+
+	args = []string{"COMMAND", "COUNT"}
+	client.Write(r.ToArray(args))
+	count := readBuffer(client)
+	assert.Equal(t, byte(':'), count[0])
+
+	// COMMAND lists every command COUNT counted
+	args = []string{"COMMAND"}
+	client.Write(r.ToArray(args))
+	header := readBytes(client, len(count))
+	assert.Equal(t, "*"+string(count[1:]), string(header))
+}
+
+func TestCOMMAND2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"COMMAND", "GETKEYS", "SET", "key", "value", "EX", "10"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToArray([]string{"key"}), response)
+
+	args = []string{"COMMAND", "GETKEYS", "DEL", "key1", "key2", "key3"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToArray([]string{"key1", "key2", "key3"}), response)
+
+	args = []string{"COMMAND", "GETKEYS", "PING"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR The command has no key arguments"), response)
+
+	args = []string{"COMMAND", "GETKEYS", "GET"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Invalid number of arguments specified for command"), response)
+
+	args = []string{"COMMAND", "GETKEYS", "PEEK", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Invalid command specified"), response)
+}
+
+func TestCOMMAND3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// the arity is checked before any handler runs
+	args := []string{"get", "key", "extra"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'get' command"), response)
+}
+
+func TestGET1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// rpush
+	args := []string{"RPUSH", "key", "0"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	// get
+	args = []string{"GET", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value"), response)
+}
+
+func TestExpireOverwrite1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "session", "old", "PX", "100"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	// overwriting the key drops the old expiration time
+	args = []string{"SET", "session", "new"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	time.Sleep(200 * time.Millisecond)
+	args = []string{"GET", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("new"), response)
+}
+
+func TestExpireOverwrite2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "session", "old", "PX", "100"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"SET", "session", "new", "PX", "500"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	// the first expiration time no longer applies
+	time.Sleep(200 * time.Millisecond)
+	args = []string{"GET", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("new"), response)
+
+	// the second one does
+	time.Sleep(400 * time.Millisecond)
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+}
+
+func TestExpireKeepTTL(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "counter", "10", "PX", "100"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	// modifying a value keeps its expiration time
+	args = []string{"INCR", "counter"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(11), response)
+
+	time.Sleep(200 * time.Millisecond)
+	args = []string{"EXISTS", "counter"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+}
+
+func TestActiveExpire(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	for i := 0; i < 100; i++ {
+		args := []string{"SET", fmt.Sprintf("key:%d", i), "value", "PX", "50"}
+		client.Write(r.ToArray(args))
+		response := readBuffer(client)
+		assert.Equal(t, r.ToSimpleString("OK"), response)
+	}
+	args := []string{"SET", "persistent", "value"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	// nothing has expired yet
+	assert.Equal(t, 0, utils.ActiveExpireCycle())
+
+	// keys that are never accessed again are still deleted
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 100, utils.ActiveExpireCycle())
+
+	args = []string{"EXISTS", "persistent"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+}
+
+func TestEXPIRE1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"EXPIRE", "missing", "10"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+
+	args = []string{"SET", "session", "token"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"TTL", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-1), response)
+
+	args = []string{"EXPIRE", "session", "100"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"TTL", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(100), response)
+
+	// sliding the TTL on access
+	args = []string{"PEXPIRE", "session", "200000"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"TTL", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(200), response)
+
+	args = []string{"PERSIST", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"PERSIST", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+
+	args = []string{"PTTL", "session"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-1), response)
+
+	args = []string{"TTL", "missing"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-2), response)
+}
+
+func TestEXPIRE2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"RPUSH", "queue", "job"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	runCases(t, client, []testCase{
+		{[]string{"EXPIRE", "queue", "100", "XX"}, r.ToInteger(0)},
+		{[]string{"EXPIRE", "queue", "100", "GT"}, r.ToInteger(0)},
+		{[]string{"EXPIRE", "queue", "100", "NX"}, r.ToInteger(1)},
+		{[]string{"EXPIRE", "queue", "200", "NX"}, r.ToInteger(0)},
+		{[]string{"EXPIRE", "queue", "50", "GT"}, r.ToInteger(0)},
+		{[]string{"EXPIRE", "queue", "200", "GT"}, r.ToInteger(1)},
+		{[]string{"EXPIRE", "queue", "300", "LT"}, r.ToInteger(0)},
+		{[]string{"EXPIRE", "queue", "150", "XX", "LT"}, r.ToInteger(1)},
+	})
+
+	args = []string{"TTL", "queue"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(150), response)
+}
+
+func TestEXPIRE3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "key", "value"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"EXPIRE", "key", "10", "NX", "GT"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR NX and XX, GT or LT options at the same time are not compatible"), response)
+
+	args = []string{"EXPIRE", "key", "10", "GT", "LT"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR GT and LT options at the same time are not compatible"), response)
+
+	args = []string{"EXPIRE", "key", "10", "SOON"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Unsupported option SOON"), response)
+
+	args = []string{"EXPIRE", "key", "ten"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR value is not an integer or out of range"), response)
+
+	args = []string{"EXPIRE", "key", "9223372036854775807"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'expire' command"), response)
+
+	// a time in the past deletes the key
+	args = []string{"EXPIRE", "key", "-1"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"EXISTS", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+}
+
+func TestEXPIREAT(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "key", "value"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"EXPIRETIME", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-1), response)
+
+	timestamp := time.Now().Add(time.Hour).UnixMilli()
+	args = []string{"PEXPIREAT", "key", strconv.FormatInt(timestamp, 10)}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"PEXPIRETIME", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(int(timestamp)), response)
+
+	args = []string{"EXPIREAT", "key", strconv.FormatInt(timestamp/1000+60, 10)}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"EXPIRETIME", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(int(timestamp/1000+60)), response)
+
+	args = []string{"EXPIRETIME", "missing"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-2), response)
+}
+
+func TestSETNX1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// the distributed lock pattern
+	args := []string{"SET", "lock", "token-1", "NX", "PX", "30000"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"set", "lock", "token-2", "px", "30000", "nx"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+
+	args = []string{"GET", "lock"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("token-1"), response)
+
+	args = []string{"PTTL", "lock"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	ttl, _ := strconv.Atoi(string(response[1 : len(response)-2]))
+	assert.InDelta(t, 30000, ttl, 100)
+}
+
+func TestSETXX(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "key", "value", "XX"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+
+	args = []string{"EXISTS", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+
+	args = []string{"SET", "key", "value"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"SET", "key", "updated", "XX"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"GET", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("updated"), response)
+}
+
+func TestSETGET(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "key", "first", "GET"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+
+	args = []string{"SET", "key", "second", "GET", "EX", "100"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("first"), response)
+
+	// NX with GET replies with the value that blocked the write
+	args = []string{"SET", "key", "third", "NX", "GET"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("second"), response)
+
+	args = []string{"RPUSH", "list", "element"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"SET", "list", "value", "GET"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value"), response)
+}
+
+func TestSETKEEPTTL(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SET", "key", "value", "EX", "100"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"SET", "key", "updated", "KEEPTTL"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"TTL", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(100), response)
+
+	args = []string{"SET", "key", "updated"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"TTL", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-1), response)
+}
+
+func TestSETSyntax(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	for _, options := range [][]string{
+		{"NX", "XX"},
+		{"EX", "10", "PX", "100"},
+		{"EX", "10", "KEEPTTL"},
+		{"KEEPTTL", "PXAT", "100"},
+		{"EX"},
+		{"FOREVER"},
+	} {
+		args := append([]string{"SET", "key", "value"}, options...)
+		client.Write(r.ToArray(args))
+		response := readBuffer(client)
+		assert.Equal(t, r.ToSimpleError("ERR syntax error"), response, options)
+	}
+
+	args := []string{"SET", "key", "value", "EX", "9223372036854775807"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'set' command"), response)
+}
+
+func TestLegacySET(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"SETNX", "key", "first"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	args = []string{"SETNX", "key", "second"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+
+	args = []string{"GETSET", "key", "third"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("first"), response)
+
+	args = []string{"SETEX", "key", "100", "fourth"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"TTL", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(100), response)
+
+	// GETSET discards the TTL
+	args = []string{"GETSET", "key", "fifth"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("fourth"), response)
+
+	args = []string{"TTL", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(-1), response)
+
+	args = []string{"PSETEX", "key", "100000", "sixth"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"TTL", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(100), response)
+
+	args = []string{"SETEX", "key", "0", "value"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR invalid expire time in 'setex' command"), response)
+
+	args = []string{"GETSET", "missing", "value"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+}
+
+func TestINCRBY(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"INCRBY", "counter", "10"}, r.ToInteger(10)},
+		{[]string{"INCRBY", "counter", "-15"}, r.ToInteger(-5)},
+		{[]string{"DECRBY", "counter", "5"}, r.ToInteger(-10)},
+		{[]string{"DECRBY", "counter", "-20"}, r.ToInteger(10)},
+		{[]string{"INCRBY", "counter", "ten"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"INCRBY", "counter", "+1"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"INCRBY", "counter", "01"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"INCRBY", "counter", "9223372036854775808"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"GET", "counter"}, r.ToBulkString("10")},
+	})
+}
+
+func TestINCRBYOverflow(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "max", "9223372036854775807"}, r.ToSimpleString("OK")},
+		{[]string{"INCR", "max"}, r.ToSimpleError("ERR increment or decrement would overflow")},
+		{[]string{"INCRBY", "max", "1"}, r.ToSimpleError("ERR increment or decrement would overflow")},
+		{[]string{"DECRBY", "max", "-1"}, r.ToSimpleError("ERR increment or decrement would overflow")},
+		{[]string{"GET", "max"}, r.ToBulkString("9223372036854775807")},
+		{[]string{"SET", "min", "-9223372036854775808"}, r.ToSimpleString("OK")},
+		{[]string{"DECR", "min"}, r.ToSimpleError("ERR increment or decrement would overflow")},
+		{[]string{"INCRBY", "min", "-9223372036854775808"}, r.ToSimpleError("ERR increment or decrement would overflow")},
+		{[]string{"DECRBY", "other", "-9223372036854775808"}, r.ToSimpleError("ERR decrement would overflow")},
+		{[]string{"INCRBY", "min", "9223372036854775807"}, r.ToInteger(-1)},
+	})
+}
+
+func TestINCRBYFLOAT(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "price", "10.50"}, r.ToSimpleString("OK")},
+		{[]string{"INCRBYFLOAT", "price", "0.1"}, r.ToBulkString("10.6")},
+		{[]string{"INCRBYFLOAT", "price", "-5"}, r.ToBulkString("5.6")},
+		{[]string{"SET", "price", "5.0e3"}, r.ToSimpleString("OK")},
+		{[]string{"INCRBYFLOAT", "price", "2.0e2"}, r.ToBulkString("5200")},
+		{[]string{"INCRBYFLOAT", "sum", "0.1"}, r.ToBulkString("0.1")},
+		{[]string{"INCRBYFLOAT", "sum", "0.2"}, r.ToBulkString("0.3")},
+		{[]string{"INCRBYFLOAT", "sum", "-0.3"}, r.ToBulkString("0")},
+		{[]string{"INCRBYFLOAT", "sum", "1e20"}, r.ToBulkString("100000000000000000000")},
+		{[]string{"INCRBYFLOAT", "sum", "abc"}, r.ToSimpleError("ERR value is not a valid float")},
+		{[]string{"INCRBYFLOAT", "sum", "nan"}, r.ToSimpleError("ERR value is not a valid float")},
+		{[]string{"INCRBYFLOAT", "sum", "inf"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		// long doubles overflow above 1.18e4932
+		{[]string{"INCRBYFLOAT", "sum", "1e5000"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		{[]string{"SET", "huge", "1e4932"}, r.ToSimpleString("OK")},
+		{[]string{"INCRBYFLOAT", "huge", "1e4932"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		{[]string{"GET", "huge"}, r.ToBulkString("1e4932")},
+		{[]string{"SET", "huge", "-1e5000"}, r.ToSimpleString("OK")},
+		{[]string{"INCRBYFLOAT", "huge", "1"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		{[]string{"SET", "name", "bob"}, r.ToSimpleString("OK")},
+		{[]string{"INCRBYFLOAT", "name", "1"}, r.ToSimpleError("ERR value is not a valid float")},
+	})
+}
+
+func TestMSET(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"MSET", "key1", "value1", "key2", "value2"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"RPUSH", "list", "element"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	// missing keys and other types come back as nil
+	args = []string{"MGET", "key1", "missing", "list", "key2"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	expected := "*4\r\n$6\r\nvalue1\r\n$-1\r\n$-1\r\n$6\r\nvalue2\r\n"
+	assert.Equal(t, []byte(expected), response)
+
+	args = []string{"MSET", "key1", "value1", "key2"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR wrong number of arguments for 'mset' command"), response)
+
+	args = []string{"COMMAND", "GETKEYS", "MSET", "key1", "value1", "key2", "value2"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToArray([]string{"key1", "key2"}), response)
+}
+
+func TestMSETNX(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"MSETNX", "key1", "value1", "key2", "value2"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(1), response)
+
+	// all or nothing
+	args = []string{"MSETNX", "key3", "value3", "key2", "updated"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+
+	args = []string{"MGET", "key1", "key2", "key3"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	expected := "*3\r\n$6\r\nvalue1\r\n$6\r\nvalue2\r\n$-1\r\n"
+	assert.Equal(t, []byte(expected), response)
+}
+
+func TestAPPEND(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"APPEND", "greeting", "Hello"}, r.ToInteger(5)},
+		{[]string{"APPEND", "greeting", " World"}, r.ToInteger(11)},
+		{[]string{"GET", "greeting"}, r.ToBulkString("Hello World")},
+		{[]string{"STRLEN", "greeting"}, r.ToInteger(11)},
+		{[]string{"STRLEN", "missing"}, r.ToInteger(0)},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"APPEND", "list", "value"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"STRLEN", "list"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestGETRANGE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "mykey", "This is a string"}, r.ToSimpleString("OK")},
+		{[]string{"GETRANGE", "mykey", "0", "3"}, r.ToBulkString("This")},
+		{[]string{"GETRANGE", "mykey", "-3", "-1"}, r.ToBulkString("ing")},
+		{[]string{"GETRANGE", "mykey", "0", "-1"}, r.ToBulkString("This is a string")},
+		{[]string{"GETRANGE", "mykey", "10", "100"}, r.ToBulkString("string")},
+		{[]string{"GETRANGE", "mykey", "5", "3"}, r.ToBulkString("")},
+		{[]string{"GETRANGE", "mykey", "-100", "-50"}, r.ToBulkString("")},
+		{[]string{"GETRANGE", "missing", "0", "-1"}, r.ToBulkString("")},
+		{[]string{"GETRANGE", "mykey", "0", "end"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"GETRANGE", "list", "0", "-1"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestSETRANGE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "key1", "Hello World"}, r.ToSimpleString("OK")},
+		{[]string{"SETRANGE", "key1", "6", "Redis"}, r.ToInteger(11)},
+		{[]string{"GET", "key1"}, r.ToBulkString("Hello Redis")},
+		// missing keys and gaps are zero padded
+		{[]string{"SETRANGE", "key2", "6", "Redis"}, r.ToInteger(11)},
+		{[]string{"GET", "key2"}, r.ToBulkString("\x00\x00\x00\x00\x00\x00Redis")},
+		{[]string{"SETRANGE", "key1", "13", "!"}, r.ToInteger(14)},
+		{[]string{"GET", "key1"}, r.ToBulkString("Hello Redis\x00\x00!")},
+		{[]string{"SETRANGE", "key3", "5", ""}, r.ToInteger(0)},
+		{[]string{"EXISTS", "key3"}, r.ToInteger(0)},
+		{[]string{"SETRANGE", "key1", "-1", "x"}, r.ToSimpleError("ERR offset is out of range")},
+		{[]string{"SETRANGE", "key1", "536870912", "x"}, r.ToSimpleError("ERR string exceeds maximum allowed size (proto-max-bulk-len)")},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"SETRANGE", "list", "0", "x"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestGETDEL(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "key", "value"}, r.ToSimpleString("OK")},
+		{[]string{"GETDEL", "key"}, r.ToBulkString("value")},
+		{[]string{"GETDEL", "key"}, r.ToNullBulkString()},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"GETDEL", "list"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"EXISTS", "list"}, r.ToInteger(1)},
+	})
+}
+
+func TestGETEX(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "key", "value"}, r.ToSimpleString("OK")},
+		{[]string{"GETEX", "key"}, r.ToBulkString("value")},
+		{[]string{"TTL", "key"}, r.ToInteger(-1)},
+		{[]string{"GETEX", "key", "EX", "100"}, r.ToBulkString("value")},
+		{[]string{"TTL", "key"}, r.ToInteger(100)},
+		{[]string{"GETEX", "key", "PX", "200000"}, r.ToBulkString("value")},
+		{[]string{"TTL", "key"}, r.ToInteger(200)},
+		{[]string{"GETEX", "key", "PERSIST"}, r.ToBulkString("value")},
+		{[]string{"TTL", "key"}, r.ToInteger(-1)},
+		{[]string{"GETEX", "key", "EX", "10", "PERSIST"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"GETEX", "key", "EX", "0"}, r.ToSimpleError("ERR invalid expire time in 'getex' command")},
+		{[]string{"GETEX", "missing", "EX", "10"}, r.ToNullBulkString()},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"GETEX", "list"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLCS(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"MSET", "key1", "ohmytext", "key2", "mynewtext"}, r.ToSimpleString("OK")},
+		{[]string{"LCS", "key1", "key2"}, r.ToBulkString("mytext")},
+		{[]string{"LCS", "key1", "key2", "LEN"}, r.ToInteger(6)},
+		{[]string{"LCS", "key1", "key2", "IDX"}, []byte("*4\r\n$7\r\nmatches\r\n*2\r\n" +
+			"*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n" +
+			"*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n" +
+			"$3\r\nlen\r\n:6\r\n")},
+		{[]string{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"}, []byte("*4\r\n$7\r\nmatches\r\n*1\r\n" +
+			"*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n" +
+			"$3\r\nlen\r\n:6\r\n")},
+		{[]string{"LCS", "key1", "missing"}, r.ToBulkString("")},
+		{[]string{"LCS", "key1", "key2", "LEN", "IDX"}, r.ToSimpleError("ERR If you want both the length and indexes, please just use IDX.")},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"LCS", "key1", "list"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLRANGE4(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	args := []string{"RPUSH", "key", "0", "1", "2"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(3), response)
+
+	// a stop before the start of the list is an empty range
+	args = []string{"LRANGE", "key", "0", "-100"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToArray([]string{}), response)
+}
+
+func TestSETBIT(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SETBIT", "mykey", "7", "1"}, r.ToInteger(0)},
+		{[]string{"SETBIT", "mykey", "7", "0"}, r.ToInteger(1)},
+		{[]string{"GET", "mykey"}, r.ToBulkString("\x00")},
+		// the string grows to hold the bit
+		{[]string{"SETBIT", "mykey", "23", "1"}, r.ToInteger(0)},
+		{[]string{"GET", "mykey"}, r.ToBulkString("\x00\x00\x01")},
+		{[]string{"SETBIT", "mykey", "0", "1"}, r.ToInteger(0)},
+		{[]string{"GET", "mykey"}, r.ToBulkString("\x80\x00\x01")},
+		{[]string{"GETBIT", "mykey", "0"}, r.ToInteger(1)},
+		{[]string{"GETBIT", "mykey", "1"}, r.ToInteger(0)},
+		{[]string{"GETBIT", "mykey", "23"}, r.ToInteger(1)},
+		{[]string{"GETBIT", "mykey", "100"}, r.ToInteger(0)},
+		{[]string{"GETBIT", "missing", "0"}, r.ToInteger(0)},
+		{[]string{"SETBIT", "mykey", "-1", "1"}, r.ToSimpleError("ERR bit offset is not an integer or out of range")},
+		{[]string{"SETBIT", "mykey", "4294967296", "1"}, r.ToSimpleError("ERR bit offset is not an integer or out of range")},
+		{[]string{"SETBIT", "mykey", "0", "2"}, r.ToSimpleError("ERR bit is not an integer or out of range")},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"SETBIT", "list", "0", "1"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"GETBIT", "list", "0"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestBITCOUNT(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "mykey", "foobar"}, r.ToSimpleString("OK")},
+		{[]string{"BITCOUNT", "mykey"}, r.ToInteger(26)},
+		{[]string{"BITCOUNT", "mykey", "0", "0"}, r.ToInteger(4)},
+		{[]string{"BITCOUNT", "mykey", "1", "1"}, r.ToInteger(6)},
+		{[]string{"BITCOUNT", "mykey", "1", "1", "BYTE"}, r.ToInteger(6)},
+		{[]string{"BITCOUNT", "mykey", "-2", "-1"}, r.ToInteger(7)},
+		{[]string{"BITCOUNT", "mykey", "5", "30", "BIT"}, r.ToInteger(17)},
+		{[]string{"BITCOUNT", "mykey", "2", "1"}, r.ToInteger(0)},
+		{[]string{"BITCOUNT", "missing"}, r.ToInteger(0)},
+		{[]string{"BITCOUNT", "mykey", "0"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"BITCOUNT", "mykey", "0", "1", "WORD"}, r.ToSimpleError("ERR syntax error")},
+	})
+}
+
+func TestBITPOS(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "mykey", "\xff\xf0\x00"}, r.ToSimpleString("OK")},
+		{[]string{"BITPOS", "mykey", "0"}, r.ToInteger(12)},
+		{[]string{"SET", "mykey", "\x00\xff\xf0"}, r.ToSimpleString("OK")},
+		{[]string{"BITPOS", "mykey", "1", "0"}, r.ToInteger(8)},
+		{[]string{"BITPOS", "mykey", "1", "2"}, r.ToInteger(16)},
+		{[]string{"BITPOS", "mykey", "1", "2", "-1", "BYTE"}, r.ToInteger(16)},
+		{[]string{"BITPOS", "mykey", "1", "7", "15", "BIT"}, r.ToInteger(8)},
+		{[]string{"SET", "mykey", "\x00\x00\x00"}, r.ToSimpleString("OK")},
+		{[]string{"BITPOS", "mykey", "1"}, r.ToInteger(-1)},
+		{[]string{"BITPOS", "mykey", "1", "7", "-3", "BIT"}, r.ToInteger(-1)},
+		// with no end, the string is padded with clear bits
+		{[]string{"SET", "mykey", "\xff\xff\xff"}, r.ToSimpleString("OK")},
+		{[]string{"BITPOS", "mykey", "0"}, r.ToInteger(24)},
+		{[]string{"BITPOS", "mykey", "0", "1"}, r.ToInteger(24)},
+		{[]string{"BITPOS", "mykey", "0", "0", "-1"}, r.ToInteger(-1)},
+		{[]string{"BITPOS", "missing", "0"}, r.ToInteger(0)},
+		{[]string{"BITPOS", "missing", "1"}, r.ToInteger(-1)},
+		{[]string{"BITPOS", "mykey", "2"}, r.ToSimpleError("ERR The bit argument must be 1 or 0.")},
+	})
+}
+
+func TestBITOP(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "key1", "foobar"}, r.ToSimpleString("OK")},
+		{[]string{"SET", "key2", "abcdef"}, r.ToSimpleString("OK")},
+		{[]string{"BITOP", "AND", "dest", "key1", "key2"}, r.ToInteger(6)},
+		{[]string{"GET", "dest"}, r.ToBulkString("`bc`ab")},
+		{[]string{"BITOP", "OR", "dest", "key1", "key2"}, r.ToInteger(6)},
+		{[]string{"GET", "dest"}, r.ToBulkString("goofev")},
+		{[]string{"BITOP", "XOR", "dest", "key1", "key1"}, r.ToInteger(6)},
+		{[]string{"GET", "dest"}, r.ToBulkString("\x00\x00\x00\x00\x00\x00")},
+		// shorter and missing keys are padded with zero bytes
+		{[]string{"SET", "short", "\xff"}, r.ToSimpleString("OK")},
+		{[]string{"BITOP", "OR", "dest", "short", "missing", "key1"}, r.ToInteger(6)},
+		{[]string{"GET", "dest"}, r.ToBulkString("\xffoobar")},
+		{[]string{"BITOP", "NOT", "dest", "short"}, r.ToInteger(1)},
+		{[]string{"GET", "dest"}, r.ToBulkString("\x00")},
+		{[]string{"BITOP", "AND", "dest", "missing"}, r.ToInteger(0)},
+		{[]string{"EXISTS", "dest"}, r.ToInteger(0)},
+		{[]string{"BITOP", "NOT", "dest", "key1", "key2"}, r.ToSimpleError("ERR BITOP NOT must be called with a single source key.")},
+		{[]string{"BITOP", "NAND", "dest", "key1"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"BITOP", "AND", "dest", "key1", "list"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestBITFIELD(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"BITFIELD", "mykey", "INCRBY", "i5", "100", "1", "GET", "u4", "0"}, []byte("*2\r\n:1\r\n:0\r\n")},
+		{[]string{"BITFIELD", "mykey", "SET", "u8", "0", "255", "GET", "u8", "0", "GET", "i8", "0"}, []byte("*3\r\n:0\r\n:255\r\n:-1\r\n")},
+		{[]string{"GET", "mykey"}, r.ToBulkString("\xff\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80")},
+		// positional offsets are multiplied by the width
+		{[]string{"BITFIELD", "counters", "SET", "u8", "#1", "7", "SET", "u8", "#2", "9"}, []byte("*2\r\n:0\r\n:0\r\n")},
+		{[]string{"GET", "counters"}, r.ToBulkString("\x00\x07\x09")},
+		{[]string{"BITFIELD", "counters", "INCRBY", "u8", "#1", "3", "GET", "u16", "8"}, []byte("*2\r\n:10\r\n:2569\r\n")},
+		// overflows
+		{[]string{"BITFIELD", "of", "SET", "u2", "0", "3", "INCRBY", "u2", "0", "1"}, []byte("*2\r\n:0\r\n:0\r\n")},
+		{[]string{"BITFIELD", "of", "SET", "u2", "0", "3", "OVERFLOW", "SAT", "INCRBY", "u2", "0", "1"}, []byte("*2\r\n:0\r\n:3\r\n")},
+		{[]string{"BITFIELD", "of", "OVERFLOW", "FAIL", "INCRBY", "u2", "0", "1", "GET", "u2", "0"}, []byte("*2\r\n$-1\r\n:3\r\n")},
+		{[]string{"BITFIELD", "of", "SET", "i8", "8", "127", "INCRBY", "i8", "8", "1"}, []byte("*2\r\n:0\r\n:-128\r\n")},
+		{[]string{"BITFIELD", "of", "OVERFLOW", "SAT", "INCRBY", "i8", "8", "-1", "INCRBY", "i8", "8", "-100"}, []byte("*2\r\n:-128\r\n:-128\r\n")},
+		{[]string{"BITFIELD", "of", "OVERFLOW", "FAIL", "SET", "i8", "8", "128", "GET", "i8", "8"}, []byte("*2\r\n$-1\r\n:-128\r\n")},
+		// overflows that cross zero
+		{[]string{"BITFIELD", "i8", "SET", "i8", "0", "-1", "INCRBY", "i8", "0", "200"}, []byte("*2\r\n:0\r\n:-57\r\n")},
+		{[]string{"BITFIELD", "i8", "SET", "i8", "0", "-1", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "200"}, []byte("*2\r\n:-57\r\n:127\r\n")},
+		{[]string{"BITFIELD", "i8", "SET", "i8", "0", "-1", "OVERFLOW", "FAIL", "INCRBY", "i8", "0", "200", "GET", "i8", "0"}, []byte("*3\r\n:127\r\n$-1\r\n:-1\r\n")},
+		{[]string{"BITFIELD", "i8", "SET", "i8", "0", "1", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "-200"}, []byte("*2\r\n:-1\r\n:-128\r\n")},
+		{[]string{"BITFIELD", "i8", "OVERFLOW", "SAT", "SET", "i8", "0", "-200", "GET", "i8", "0"}, []byte("*2\r\n:-128\r\n:-128\r\n")},
+		{[]string{"BITFIELD", "of", "SET", "i64", "16", "9223372036854775807", "INCRBY", "i64", "16", "1"}, []byte("*2\r\n:0\r\n:-9223372036854775808\r\n")},
+		{[]string{"BITFIELD", "i64", "SET", "i64", "0", "5", "OVERFLOW", "SAT", "INCRBY", "i64", "0", "1"}, []byte("*2\r\n:0\r\n:6\r\n")},
+		{[]string{"BITFIELD", "i64", "OVERFLOW", "FAIL", "INCRBY", "i64", "0", "1", "INCRBY", "i64", "0", "-7"}, []byte("*2\r\n:7\r\n:0\r\n")},
+		{[]string{"BITFIELD", "i64", "OVERFLOW", "WRAP", "INCRBY", "i64", "0", "-5"}, []byte("*1\r\n:-5\r\n")},
+		{[]string{"BITFIELD", "i64", "OVERFLOW", "SAT", "INCRBY", "i64", "0", "1", "INCRBY", "i64", "0", "9223372036854775807"}, []byte("*2\r\n:-4\r\n:9223372036854775803\r\n")},
+		{[]string{"BITFIELD", "i64", "OVERFLOW", "SAT", "INCRBY", "i64", "0", "100"}, []byte("*1\r\n:9223372036854775807\r\n")},
+		{[]string{"BITFIELD", "i64", "OVERFLOW", "FAIL", "INCRBY", "i64", "0", "1", "GET", "i64", "0"}, []byte("*2\r\n$-1\r\n:9223372036854775807\r\n")},
+		{[]string{"BITFIELD", "i64", "SET", "i64", "0", "-5", "OVERFLOW", "FAIL", "INCRBY", "i64", "0", "1", "INCRBY", "i64", "0", "-9223372036854775808"}, []byte("*3\r\n:9223372036854775807\r\n:-4\r\n$-1\r\n")},
+		{[]string{"BITFIELD", "i64", "OVERFLOW", "SAT", "INCRBY", "i64", "0", "-9223372036854775808"}, []byte("*1\r\n:-9223372036854775808\r\n")},
+		{[]string{"BITFIELD", "i64", "SET", "i64", "0", "-5", "OVERFLOW", "WRAP", "INCRBY", "i64", "0", "-9223372036854775808"}, []byte("*2\r\n:-9223372036854775808\r\n:9223372036854775803\r\n")},
+		{[]string{"BITFIELD", "of", "SET", "u63", "16", "9223372036854775807", "GET", "u63", "16"}, []byte("*2\r\n:4611686018427387904\r\n:9223372036854775807\r\n")},
+		// reads don't create the key
+		{[]string{"BITFIELD", "missing", "GET", "u8", "0"}, []byte("*1\r\n:0\r\n")},
+		{[]string{"EXISTS", "missing"}, r.ToInteger(0)},
+		{[]string{"BITFIELD", "mykey"}, []byte("*0\r\n")},
+		{[]string{"BITFIELD", "mykey", "GET", "u64", "0"}, r.ToSimpleError("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")},
+		{[]string{"BITFIELD", "mykey", "GET", "x8", "0"}, r.ToSimpleError("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")},
+		{[]string{"BITFIELD", "mykey", "GET", "u8", "-1"}, r.ToSimpleError("ERR bit offset is not an integer or out of range")},
+		{[]string{"BITFIELD", "mykey", "OVERFLOW", "CLAMP"}, r.ToSimpleError("ERR Invalid OVERFLOW type specified")},
+		{[]string{"BITFIELD", "mykey", "SET", "u8", "0"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"BITFIELD", "mykey", "SET", "u8", "0", "x"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"RPUSH", "list", "element"}, r.ToInteger(1)},
+		{[]string{"BITFIELD", "list", "GET", "u8", "0"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestBITFIELD_RO(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SET", "mykey", "\x01\x02"}, r.ToSimpleString("OK")},
+		{[]string{"BITFIELD_RO", "mykey", "GET", "u8", "0", "GET", "u8", "#1", "GET", "u16", "0"}, []byte("*3\r\n:1\r\n:2\r\n:258\r\n")},
+		{[]string{"BITFIELD_RO", "mykey", "SET", "u8", "0", "1"}, r.ToSimpleError("ERR BITFIELD_RO only supports the GET subcommand")},
+		{[]string{"BITFIELD_RO", "mykey", "INCRBY", "u8", "0", "1"}, r.ToSimpleError("ERR BITFIELD_RO only supports the GET subcommand")},
+		{[]string{"GET", "mykey"}, r.ToBulkString("\x01\x02")},
+	})
+}
+
+func TestLPOP(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "one", "two", "three", "four", "five"}, r.ToInteger(5)},
+		{[]string{"LPOP", "mylist"}, r.ToBulkString("one")},
+		{[]string{"RPOP", "mylist"}, r.ToBulkString("five")},
+		{[]string{"LPOP", "mylist", "2"}, r.ToArray([]string{"two", "three"})},
+		{[]string{"LPOP", "mylist", "0"}, r.ToArray([]string{})},
+		{[]string{"RPOP", "mylist", "5"}, r.ToArray([]string{"four"})},
+		// popping the last element deletes the key
+		{[]string{"EXISTS", "mylist"}, r.ToInteger(0)},
+		{[]string{"LPOP", "mylist"}, r.ToNullBulkString()},
+		{[]string{"RPOP", "mylist", "2"}, r.ToNullArray()},
+		{[]string{"RPUSH", "mylist", "a", "b", "c"}, r.ToInteger(3)},
+		{[]string{"RPOP", "mylist", "2"}, r.ToArray([]string{"c", "b"})},
+		{[]string{"LPOP", "mylist", "-1"}, r.ToSimpleError("ERR value is out of range, must be positive")},
+		{[]string{"LPOP", "mylist", "1", "2"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LPOP", "string"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"RPOP", "string"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLINDEX(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "Hello", "World"}, r.ToInteger(2)},
+		{[]string{"LLEN", "mylist"}, r.ToInteger(2)},
+		{[]string{"LLEN", "missing"}, r.ToInteger(0)},
+		{[]string{"LINDEX", "mylist", "0"}, r.ToBulkString("Hello")},
+		{[]string{"LINDEX", "mylist", "-1"}, r.ToBulkString("World")},
+		{[]string{"LINDEX", "mylist", "2"}, r.ToNullBulkString()},
+		{[]string{"LINDEX", "mylist", "-3"}, r.ToNullBulkString()},
+		{[]string{"LINDEX", "missing", "0"}, r.ToNullBulkString()},
+		{[]string{"LSET", "mylist", "0", "Goodbye"}, r.ToSimpleString("OK")},
+		{[]string{"LSET", "mylist", "-1", "Moon"}, r.ToSimpleString("OK")},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"Goodbye", "Moon"})},
+		{[]string{"LSET", "mylist", "2", "Sun"}, r.ToSimpleError("ERR index out of range")},
+		{[]string{"LSET", "missing", "0", "Sun"}, r.ToSimpleError("ERR no such key")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LLEN", "string"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"LINDEX", "string", "0"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"LSET", "string", "0", "x"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLINSERT(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "Hello", "World"}, r.ToInteger(2)},
+		{[]string{"LINSERT", "mylist", "BEFORE", "World", "There"}, r.ToInteger(3)},
+		{[]string{"LINSERT", "mylist", "after", "World", "!"}, r.ToInteger(4)},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"Hello", "There", "World", "!"})},
+		{[]string{"LINSERT", "mylist", "BEFORE", "Moon", "x"}, r.ToInteger(-1)},
+		{[]string{"LINSERT", "missing", "BEFORE", "World", "x"}, r.ToInteger(0)},
+		{[]string{"EXISTS", "missing"}, r.ToInteger(0)},
+		{[]string{"LINSERT", "mylist", "AROUND", "World", "x"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LINSERT", "string", "BEFORE", "World", "x"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLREM(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "hello", "hello", "foo", "hello", "bar", "hello"}, r.ToInteger(6)},
+		{[]string{"LREM", "mylist", "-2", "hello"}, r.ToInteger(2)},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"hello", "hello", "foo", "bar"})},
+		{[]string{"LREM", "mylist", "1", "hello"}, r.ToInteger(1)},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"hello", "foo", "bar"})},
+		{[]string{"LREM", "mylist", "0", "missing"}, r.ToInteger(0)},
+		{[]string{"RPUSH", "mylist", "hello"}, r.ToInteger(4)},
+		{[]string{"LREM", "mylist", "0", "hello"}, r.ToInteger(2)},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"foo", "bar"})},
+		{[]string{"LREM", "mylist", "0", "foo"}, r.ToInteger(1)},
+		{[]string{"LREM", "mylist", "0", "bar"}, r.ToInteger(1)},
+		{[]string{"EXISTS", "mylist"}, r.ToInteger(0)},
+		{[]string{"LREM", "mylist", "0", "bar"}, r.ToInteger(0)},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LREM", "string", "0", "x"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLTRIM(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "one", "two", "three"}, r.ToInteger(3)},
+		{[]string{"LTRIM", "mylist", "1", "-1"}, r.ToSimpleString("OK")},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"two", "three"})},
+		{[]string{"LTRIM", "mylist", "0", "100"}, r.ToSimpleString("OK")},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"two", "three"})},
+		{[]string{"LTRIM", "mylist", "5", "10"}, r.ToSimpleString("OK")},
+		{[]string{"EXISTS", "mylist"}, r.ToInteger(0)},
+		{[]string{"LTRIM", "missing", "0", "1"}, r.ToSimpleString("OK")},
+		{[]string{"LTRIM", "missing", "0", "x"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LTRIM", "string", "0", "1"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestLPOS(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "a", "b", "c", "1", "2", "3", "c", "c"}, r.ToInteger(8)},
+		{[]string{"LPOS", "mylist", "c"}, r.ToInteger(2)},
+		{[]string{"LPOS", "mylist", "c", "RANK", "2"}, r.ToInteger(6)},
+		{[]string{"LPOS", "mylist", "c", "RANK", "-1"}, r.ToInteger(7)},
+		{[]string{"LPOS", "mylist", "c", "COUNT", "2"}, []byte("*2\r\n:2\r\n:6\r\n")},
+		{[]string{"LPOS", "mylist", "c", "RANK", "-1", "COUNT", "2"}, []byte("*2\r\n:7\r\n:6\r\n")},
+		{[]string{"LPOS", "mylist", "c", "COUNT", "0"}, []byte("*3\r\n:2\r\n:6\r\n:7\r\n")},
+		{[]string{"LPOS", "mylist", "c", "COUNT", "0", "MAXLEN", "7"}, []byte("*2\r\n:2\r\n:6\r\n")},
+		{[]string{"LPOS", "mylist", "c", "MAXLEN", "2"}, r.ToNullBulkString()},
+		{[]string{"LPOS", "mylist", "x"}, r.ToNullBulkString()},
+		{[]string{"LPOS", "mylist", "x", "COUNT", "1"}, r.ToArray([]string{})},
+		{[]string{"LPOS", "missing", "c"}, r.ToNullBulkString()},
+		{[]string{"LPOS", "mylist", "c", "RANK", "-9223372036854775808"}, r.ToSimpleError("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807")},
+		{[]string{"LPOS", "mylist", "c", "RANK", "0"}, r.ToSimpleError("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")},
+		{[]string{"LPOS", "mylist", "c", "COUNT", "-1"}, r.ToSimpleError("ERR COUNT can't be negative")},
+		{[]string{"LPOS", "mylist", "c", "MAXLEN", "-1"}, r.ToSimpleError("ERR MAXLEN can't be negative")},
+		{[]string{"LPOS", "mylist", "c", "COUNT"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LPOS", "string", "c"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestListWrapAround(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// pushes and pops at both ends, growing and shrinking the list, must
+	// keep the elements in order
+	expected := []string{}
+	for i := 0; i < 100; i++ {
+		element := strconv.Itoa(i)
+		if i%3 == 0 {
+			client.Write(r.ToArray([]string{"LPUSH", "mylist", element}))
+			expected = append([]string{element}, expected...)
+		} else {
+			client.Write(r.ToArray([]string{"RPUSH", "mylist", element}))
+			expected = append(expected, element)
+		}
+		assert.Equal(t, r.ToInteger(len(expected)), readBuffer(client))
+	}
+	for i := 0; i < 90; i++ {
+		if i%2 == 0 {
+			client.Write(r.ToArray([]string{"LPOP", "mylist"}))
+			assert.Equal(t, r.ToBulkString(expected[0]), readBuffer(client))
+			expected = expected[1:]
+		} else {
+			client.Write(r.ToArray([]string{"RPOP", "mylist"}))
+			assert.Equal(t, r.ToBulkString(expected[len(expected)-1]), readBuffer(client))
+			expected = expected[:len(expected)-1]
+		}
+	}
+
+	client.Write(r.ToArray([]string{"LRANGE", "mylist", "0", "-1"}))
+	assert.Equal(t, r.ToArray(expected), readBuffer(client))
+
+	client.Write(r.ToArray([]string{"LINSERT", "mylist", "BEFORE", expected[7], "x"}))
+	assert.Equal(t, r.ToInteger(11), readBuffer(client))
+	client.Write(r.ToArray([]string{"LINSERT", "mylist", "AFTER", expected[1], "y"}))
+	assert.Equal(t, r.ToInteger(12), readBuffer(client))
+	expected = append(expected[:7], append([]string{"x"}, expected[7:]...)...)
+	expected = append(expected[:2], append([]string{"y"}, expected[2:]...)...)
+
+	client.Write(r.ToArray([]string{"LRANGE", "mylist", "0", "-1"}))
+	assert.Equal(t, r.ToArray(expected), readBuffer(client))
+}
+
+func TestLPUSHArguments(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// pushing several elements to the head reverses them
+	client.Write(r.ToArray([]string{"LPUSH", "mylist", "a", "b", "c"}))
+	assert.Equal(t, r.ToInteger(3), readBuffer(client))
+	client.Write(r.ToArray([]string{"LRANGE", "mylist", "0", "-1"}))
+	assert.Equal(t, r.ToArray([]string{"c", "b", "a"}), readBuffer(client))
+}
+
+func TestLMOVE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "one", "two", "three"}, r.ToInteger(3)},
+		{[]string{"LMOVE", "mylist", "myotherlist", "RIGHT", "LEFT"}, r.ToBulkString("three")},
+		{[]string{"LMOVE", "mylist", "myotherlist", "LEFT", "RIGHT"}, r.ToBulkString("one")},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"two"})},
+		{[]string{"LRANGE", "myotherlist", "0", "-1"}, r.ToArray([]string{"three", "one"})},
+		// a list can be rotated onto itself
+		{[]string{"LMOVE", "myotherlist", "myotherlist", "LEFT", "RIGHT"}, r.ToBulkString("three")},
+		{[]string{"LRANGE", "myotherlist", "0", "-1"}, r.ToArray([]string{"one", "three"})},
+		{[]string{"LMOVE", "mylist", "mylist", "LEFT", "RIGHT"}, r.ToBulkString("two")},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"two"})},
+		// the source is deleted once empty
+		{[]string{"LMOVE", "mylist", "myotherlist", "LEFT", "LEFT"}, r.ToBulkString("two")},
+		{[]string{"EXISTS", "mylist"}, r.ToInteger(0)},
+		{[]string{"LMOVE", "mylist", "myotherlist", "LEFT", "LEFT"}, r.ToNullBulkString()},
+		{[]string{"LMOVE", "myotherlist", "mylist", "UP", "LEFT"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LMOVE", "myotherlist", "string", "LEFT", "LEFT"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"LMOVE", "string", "myotherlist", "LEFT", "LEFT"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		// nothing was popped by the failed moves
+		{[]string{"LRANGE", "myotherlist", "0", "-1"}, r.ToArray([]string{"two", "one", "three"})},
+	})
+}
+
+func TestRPOPLPUSH(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"RPUSH", "mylist", "one", "two", "three"}, r.ToInteger(3)},
+		{[]string{"RPOPLPUSH", "mylist", "myotherlist"}, r.ToBulkString("three")},
+		{[]string{"RPOPLPUSH", "mylist", "myotherlist"}, r.ToBulkString("two")},
+		{[]string{"LRANGE", "mylist", "0", "-1"}, r.ToArray([]string{"one"})},
+		{[]string{"LRANGE", "myotherlist", "0", "-1"}, r.ToArray([]string{"two", "three"})},
+		{[]string{"RPOPLPUSH", "missing", "myotherlist"}, r.ToNullBulkString()},
+	})
+}
+
+func TestLMPOP(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"LMPOP", "2", "non1", "non2", "LEFT", "COUNT", "10"}, r.ToNullArray()},
+		{[]string{"LPUSH", "mylist", "one", "two", "three", "four", "five"}, r.ToInteger(5)},
+		{[]string{"LMPOP", "1", "mylist", "LEFT"}, []byte("*2\r\n$6\r\nmylist\r\n*1\r\n$4\r\nfive\r\n")},
+		{[]string{"LMPOP", "1", "mylist", "RIGHT", "COUNT", "10"}, []byte("*2\r\n$6\r\nmylist\r\n*4\r\n$3\r\none\r\n$3\r\ntwo\r\n$5\r\nthree\r\n$4\r\nfour\r\n")},
+		{[]string{"EXISTS", "mylist"}, r.ToInteger(0)},
+		{[]string{"LPUSH", "mylist2", "a", "b"}, r.ToInteger(2)},
+		{[]string{"LMPOP", "2", "mylist", "mylist2", "right", "count", "1"}, []byte("*2\r\n$7\r\nmylist2\r\n*1\r\n$1\r\na\r\n")},
+		{[]string{"LMPOP", "0", "mylist", "LEFT"}, r.ToSimpleError("ERR numkeys should be greater than 0")},
+		{[]string{"LMPOP", "1", "mylist", "UP"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"LMPOP", "1", "mylist", "LEFT", "COUNT", "-1"}, r.ToSimpleError("ERR count should be greater than 0")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"LMPOP", "2", "string", "mylist2", "LEFT"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"COMMAND", "GETKEYS", "LMPOP", "2", "mylist", "mylist2", "LEFT"}, r.ToArray([]string{"mylist", "mylist2"})},
+	})
+}
+
+func TestHSET(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"HSET", "myhash", "field1", "Hello"}, r.ToInteger(1)},
+		{[]string{"HSET", "myhash", "field1", "Hi", "field2", "World"}, r.ToInteger(1)},
+		{[]string{"HGET", "myhash", "field1"}, r.ToBulkString("Hi")},
+		{[]string{"HGET", "myhash", "field3"}, r.ToNullBulkString()},
+		{[]string{"HGET", "missing", "field1"}, r.ToNullBulkString()},
+		{[]string{"HMGET", "myhash", "field1", "nofield", "field2"}, []byte("*3\r\n$2\r\nHi\r\n$-1\r\n$5\r\nWorld\r\n")},
+		{[]string{"HSETNX", "myhash", "field1", "Hello"}, r.ToInteger(0)},
+		{[]string{"HSETNX", "myhash", "field3", "!"}, r.ToInteger(1)},
+		{[]string{"HLEN", "myhash"}, r.ToInteger(3)},
+		{[]string{"HLEN", "missing"}, r.ToInteger(0)},
+		{[]string{"HEXISTS", "myhash", "field3"}, r.ToInteger(1)},
+		{[]string{"HEXISTS", "myhash", "field4"}, r.ToInteger(0)},
+		{[]string{"HSTRLEN", "myhash", "field2"}, r.ToInteger(5)},
+		{[]string{"HSTRLEN", "myhash", "field4"}, r.ToInteger(0)},
+		{[]string{"HSET", "myhash", "field1"}, r.ToSimpleError("ERR wrong number of arguments for 'hset' command")},
+	})
+}
+
+func TestHDEL(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"HSET", "myhash", "field1", "foo", "field2", "bar"}, r.ToInteger(2)},
+		{[]string{"HDEL", "myhash", "field1", "field3"}, r.ToInteger(1)},
+		{[]string{"HDEL", "myhash", "field1"}, r.ToInteger(0)},
+		{[]string{"HGET", "myhash", "field2"}, r.ToBulkString("bar")},
+		// deleting the last field deletes the key
+		{[]string{"HDEL", "myhash", "field2"}, r.ToInteger(1)},
+		{[]string{"EXISTS", "myhash"}, r.ToInteger(0)},
+		{[]string{"HDEL", "myhash", "field2"}, r.ToInteger(0)},
+	})
+}
+
+func TestHGETALL(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"HSET", "myhash", "field1", "Hello", "field2", "World"}))
+	assert.Equal(t, r.ToInteger(2), readBuffer(client))
+
+	// fields come in no particular order
+	client.Write(r.ToArray([]string{"HKEYS", "myhash"}))
+	assert.ElementsMatch(t, []string{"field1", "field2"}, readRange(client, 2))
+	client.Write(r.ToArray([]string{"HVALS", "myhash"}))
+	assert.ElementsMatch(t, []string{"Hello", "World"}, readRange(client, 2))
+
+	client.Write(r.ToArray([]string{"HGETALL", "myhash"}))
+	elements := readRange(client, 4)
+	pairs := map[string]string{elements[0]: elements[1], elements[2]: elements[3]}
+	assert.Equal(t, map[string]string{"field1": "Hello", "field2": "World"}, pairs)
+
+	client.Write(r.ToArray([]string{"HGETALL", "missing"}))
+	assert.Equal(t, r.ToArray([]string{}), readBuffer(client))
+	client.Write(r.ToArray([]string{"HKEYS", "missing"}))
+	assert.Equal(t, r.ToArray([]string{}), readBuffer(client))
+
+	// RESP3 clients get a map
+	client.Write(r.ToArray([]string{"HELLO", "3"}))
+	readBuffer(client)
+	client.Write(r.ToArray([]string{"HDEL", "myhash", "field2"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"HGETALL", "myhash"}))
+	assert.Equal(t, []byte("%1\r\n$6\r\nfield1\r\n$5\r\nHello\r\n"), readBuffer(client))
+}
+
+func TestHINCRBY(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"HSET", "myhash", "field", "5"}, r.ToInteger(1)},
+		{[]string{"HINCRBY", "myhash", "field", "1"}, r.ToInteger(6)},
+		{[]string{"HINCRBY", "myhash", "field", "-1"}, r.ToInteger(5)},
+		{[]string{"HINCRBY", "myhash", "field", "-10"}, r.ToInteger(-5)},
+		{[]string{"HINCRBY", "myhash", "new", "3"}, r.ToInteger(3)},
+		{[]string{"HINCRBY", "newhash", "field", "7"}, r.ToInteger(7)},
+		{[]string{"HSET", "myhash", "big", "9223372036854775807", "text", "abc"}, r.ToInteger(2)},
+		{[]string{"HINCRBY", "myhash", "big", "1"}, r.ToSimpleError("ERR increment or decrement would overflow")},
+		{[]string{"HINCRBY", "myhash", "text", "1"}, r.ToSimpleError("ERR hash value is not an integer")},
+		{[]string{"HINCRBY", "myhash", "field", "x"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"HSET", "mykey", "field", "10.50"}, r.ToInteger(1)},
+		{[]string{"HINCRBYFLOAT", "mykey", "field", "0.1"}, r.ToBulkString("10.6")},
+		{[]string{"HINCRBYFLOAT", "mykey", "field", "-5"}, r.ToBulkString("5.6")},
+		{[]string{"HSET", "mykey", "field", "5.0e3"}, r.ToInteger(0)},
+		{[]string{"HINCRBYFLOAT", "mykey", "field", "2.0e2"}, r.ToBulkString("5200")},
+		{[]string{"HINCRBYFLOAT", "mykey", "new", "1.5"}, r.ToBulkString("1.5")},
+		{[]string{"HINCRBYFLOAT", "myhash", "text", "1"}, r.ToSimpleError("ERR hash value is not a float")},
+		{[]string{"HINCRBYFLOAT", "newkey", "field", "inf"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		{[]string{"HINCRBYFLOAT", "newkey", "field", "1e5000"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		{[]string{"HSET", "mykey", "huge", "-1e4932"}, r.ToInteger(1)},
+		{[]string{"HINCRBYFLOAT", "mykey", "huge", "-1e4932"}, r.ToSimpleError("ERR increment would produce NaN or Infinity")},
+		{[]string{"HGET", "mykey", "huge"}, r.ToBulkString("-1e4932")},
+		{[]string{"EXISTS", "newkey"}, r.ToInteger(0)},
+	})
+}
+
+func TestHashWrongType(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"SET", "string", "value"}))
+	readBuffer(client)
+	client.Write(r.ToArray([]string{"HSET", "hash", "field", "value"}))
+	readBuffer(client)
+
+	wrongType := r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	for _, args := range [][]string{
+		{"HSET", "string", "field", "value"},
+		{"HSETNX", "string", "field", "value"},
+		{"HGET", "string", "field"},
+		{"HMGET", "string", "field"},
+		{"HDEL", "string", "field"},
+		{"HEXISTS", "string", "field"},
+		{"HLEN", "string"},
+		{"HSTRLEN", "string", "field"},
+		{"HKEYS", "string"},
+		{"HVALS", "string"},
+		{"HGETALL", "string"},
+		{"HINCRBY", "string", "field", "1"},
+		{"HINCRBYFLOAT", "string", "field", "1"},
+		{"GET", "hash"},
+		{"APPEND", "hash", "value"},
+		{"LPUSH", "hash", "value"},
+		{"LRANGE", "hash", "0", "-1"},
+	} {
+		client.Write(r.ToArray(args))
+		assert.Equal(t, wrongType, readBuffer(client), args)
+	}
+}
+
+func TestHEXPIRE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"HSET", "myhash", "f1", "a", "f2", "b", "f3", "c"}, r.ToInteger(3)},
+		{[]string{"HEXPIRE", "myhash", "100", "FIELDS", "2", "f1", "nofield"}, []byte("*2\r\n:1\r\n:-2\r\n")},
+		{[]string{"HEXPIRE", "myhash", "50", "NX", "FIELDS", "2", "f1", "f2"}, []byte("*2\r\n:0\r\n:1\r\n")},
+		{[]string{"HEXPIRE", "myhash", "200", "XX", "FIELDS", "2", "f1", "f3"}, []byte("*2\r\n:1\r\n:0\r\n")},
+		{[]string{"HEXPIRE", "myhash", "10", "GT", "FIELDS", "2", "f1", "f3"}, []byte("*2\r\n:0\r\n:0\r\n")},
+		{[]string{"HEXPIRE", "myhash", "10", "LT", "FIELDS", "2", "f1", "f3"}, []byte("*2\r\n:1\r\n:1\r\n")},
+		{[]string{"HTTL", "myhash", "FIELDS", "4", "f1", "f2", "f3", "nofield"}, []byte("*4\r\n:10\r\n:50\r\n:10\r\n:-2\r\n")},
+		{[]string{"HPERSIST", "myhash", "FIELDS", "3", "f1", "f1", "nofield"}, []byte("*3\r\n:1\r\n:-1\r\n:-2\r\n")},
+		{[]string{"HTTL", "myhash", "FIELDS", "1", "f1"}, []byte("*1\r\n:-1\r\n")},
+		// setting a field discards its expiration time, incrementing keeps it
+		{[]string{"HSET", "myhash", "f2", "B"}, r.ToInteger(0)},
+		{[]string{"HTTL", "myhash", "FIELDS", "1", "f2"}, []byte("*1\r\n:-1\r\n")},
+		{[]string{"HSET", "myhash", "n", "1"}, r.ToInteger(1)},
+		{[]string{"HEXPIREAT", "myhash", "4102444800", "FIELDS", "1", "n"}, []byte("*1\r\n:1\r\n")},
+		{[]string{"HINCRBY", "myhash", "n", "1"}, r.ToInteger(2)},
+		{[]string{"HEXPIRETIME", "myhash", "FIELDS", "1", "n"}, []byte("*1\r\n:4102444800\r\n")},
+		{[]string{"HPEXPIRETIME", "myhash", "FIELDS", "1", "n"}, []byte("*1\r\n:4102444800000\r\n")},
+		// a time that already passed deletes the field
+		{[]string{"HEXPIRE", "myhash", "0", "FIELDS", "1", "f3"}, []byte("*1\r\n:2\r\n")},
+		{[]string{"HEXISTS", "myhash", "f3"}, r.ToInteger(0)},
+		{[]string{"HEXPIRE", "missing", "10", "FIELDS", "2", "f1", "f2"}, []byte("*2\r\n:-2\r\n:-2\r\n")},
+		{[]string{"HTTL", "missing", "FIELDS", "1", "f1"}, []byte("*1\r\n:-2\r\n")},
+		{[]string{"HPERSIST", "missing", "FIELDS", "1", "f1"}, []byte("*1\r\n:-2\r\n")},
+		{[]string{"HEXPIRE", "myhash", "10", "FIELDS", "2", "f1"}, r.ToSimpleError("ERR The `numfields` parameter must match the number of arguments")},
+		{[]string{"HEXPIRE", "myhash", "10", "FIELDS", "0", "f1"}, r.ToSimpleError("ERR Parameter `numFields` should be greater than 0")},
+		{[]string{"HEXPIRE", "myhash", "10", "FOO", "1", "f1"}, r.ToSimpleError("ERR Mandatory argument FIELDS is missing or not at the right position")},
+		{[]string{"HEXPIRE", "myhash", "-1", "FIELDS", "1", "f1"}, r.ToSimpleError("ERR invalid expire time, must be >= 0")},
+		{[]string{"HEXPIRE", "myhash", "9223372036854775807", "FIELDS", "1", "f1"}, r.ToSimpleError("ERR invalid expire time in 'hexpire' command")},
+		{[]string{"HEXPIRE", "myhash", "soon", "FIELDS", "1", "f1"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"HEXPIRE", "string", "10", "FIELDS", "1", "f1"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestHPEXPIRE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"HSET", "myhash", "f1", "a", "f2", "b"}, r.ToInteger(2)},
+		{[]string{"HPEXPIRE", "myhash", "50", "FIELDS", "1", "f1"}, []byte("*1\r\n:1\r\n")},
+		{[]string{"HPEXPIREAT", "myhash", "4102444800000", "FIELDS", "1", "f2"}, []byte("*1\r\n:1\r\n")},
+		{[]string{"HEXPIRETIME", "myhash", "FIELDS", "1", "f2"}, []byte("*1\r\n:4102444800\r\n")},
+		{[]string{"HLEN", "myhash"}, r.ToInteger(2)},
+	})
+
+	client.Write(r.ToArray([]string{"HPTTL", "myhash", "FIELDS", "1", "f1"}))
+	response := readBuffer(client)
+	ttl, err := strconv.Atoi(string(response[5 : len(response)-2]))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 50, string(response))
+
+	// expired fields are gone as soon as they're accessed
+	time.Sleep(100 * time.Millisecond)
+	runCases(t, client, []testCase{
+		{[]string{"HGET", "myhash", "f1"}, r.ToNullBulkString()},
+		{[]string{"HLEN", "myhash"}, r.ToInteger(1)},
+		{[]string{"HGETALL", "myhash"}, r.ToArray([]string{"f2", "b"})},
+		// the key is deleted with its last field
+		{[]string{"HPEXPIRE", "myhash", "50", "FIELDS", "1", "f2"}, []byte("*1\r\n:1\r\n")},
+	})
+	time.Sleep(100 * time.Millisecond)
+	client.Write(r.ToArray([]string{"HLEN", "myhash"}))
+	assert.Equal(t, r.ToInteger(0), readBuffer(client))
+	client.Write(r.ToArray([]string{"EXISTS", "myhash"}))
+	assert.Equal(t, r.ToInteger(0), readBuffer(client))
+}
+
+func TestHashActiveExpire(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("hash:%d", i)
+		client.Write(r.ToArray([]string{"HSET", key, "token", "a", "device", "b"}))
+		assert.Equal(t, r.ToInteger(2), readBuffer(client))
+		client.Write(r.ToArray([]string{"HPEXPIRE", key, "50", "FIELDS", "1", "token"}))
+		assert.Equal(t, []byte("*1\r\n:1\r\n"), readBuffer(client))
+	}
+	client.Write(r.ToArray([]string{"HSET", "single", "token", "a"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"HPEXPIRE", "single", "50", "FIELDS", "1", "token"}))
+	assert.Equal(t, []byte("*1\r\n:1\r\n"), readBuffer(client))
+
+	// nothing has expired yet
+	assert.Equal(t, 0, utils.ActiveExpireFieldsCycle())
+
+	// fields that are never accessed again are still deleted
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 51, utils.ActiveExpireFieldsCycle())
+
+	client.Write(r.ToArray([]string{"EXISTS", "single"}))
+	assert.Equal(t, r.ToInteger(0), readBuffer(client))
+	client.Write(r.ToArray([]string{"EXISTS", "hash:0"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+}
+
+func TestSADD(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SADD", "myset", "Hello", "World", "Hello"}, r.ToInteger(2)},
+		{[]string{"SADD", "myset", "World", "!"}, r.ToInteger(1)},
+		{[]string{"SCARD", "myset"}, r.ToInteger(3)},
+		{[]string{"SCARD", "missing"}, r.ToInteger(0)},
+		{[]string{"SISMEMBER", "myset", "Hello"}, r.ToInteger(1)},
+		{[]string{"SISMEMBER", "myset", "Bye"}, r.ToInteger(0)},
+		{[]string{"SMISMEMBER", "myset", "Hello", "Bye", "!"}, []byte("*3\r\n:1\r\n:0\r\n:1\r\n")},
+		{[]string{"SMISMEMBER", "missing", "Hello"}, []byte("*1\r\n:0\r\n")},
+		{[]string{"SREM", "myset", "Hello", "Bye"}, r.ToInteger(1)},
+		{[]string{"SREM", "missing", "Hello"}, r.ToInteger(0)},
+		{[]string{"SMEMBERS", "missing"}, r.ToArray([]string{})},
+		// removing the last member deletes the key
+		{[]string{"SREM", "myset", "World", "!"}, r.ToInteger(2)},
+		{[]string{"EXISTS", "myset"}, r.ToInteger(0)},
+	})
+
+	client.Write(r.ToArray([]string{"SADD", "myset", "a", "b", "c"}))
+	assert.Equal(t, r.ToInteger(3), readBuffer(client))
+	client.Write(r.ToArray([]string{"SMEMBERS", "myset"}))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, readRange(client, 3))
+
+	// RESP3 clients get a set
+	client.Write(r.ToArray([]string{"HELLO", "3"}))
+	readBuffer(client)
+	client.Write(r.ToArray([]string{"SREM", "myset", "a", "b"}))
+	assert.Equal(t, r.ToInteger(2), readBuffer(client))
+	client.Write(r.ToArray([]string{"SMEMBERS", "myset"}))
+	assert.Equal(t, []byte("~1\r\n$1\r\nc\r\n"), readBuffer(client))
+}
+
+func TestSPOP(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"SADD", "myset", "a", "b", "c", "d", "e"}))
+	assert.Equal(t, r.ToInteger(5), readBuffer(client))
+
+	client.Write(r.ToArray([]string{"SPOP", "myset"}))
+	popped := []string{string(readBuffer(client)[4:5])}
+	client.Write(r.ToArray([]string{"SPOP", "myset", "2"}))
+	popped = append(popped, readRange(client, 2)...)
+	client.Write(r.ToArray([]string{"SCARD", "myset"}))
+	assert.Equal(t, r.ToInteger(2), readBuffer(client))
+
+	// the whole set is popped when count exceeds its size
+	client.Write(r.ToArray([]string{"SPOP", "myset", "10"}))
+	popped = append(popped, readRange(client, 2)...)
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, popped)
+
+	runCases(t, client, []testCase{
+		{[]string{"EXISTS", "myset"}, r.ToInteger(0)},
+		{[]string{"SPOP", "myset"}, r.ToNullBulkString()},
+		{[]string{"SPOP", "myset", "2"}, r.ToArray([]string{})},
+		{[]string{"SPOP", "myset", "-1"}, r.ToSimpleError("ERR value is out of range, must be positive")},
+		{[]string{"SPOP", "myset", "1", "2"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"SADD", "myset", "a"}, r.ToInteger(1)},
+		{[]string{"SPOP", "myset", "0"}, r.ToArray([]string{})},
+		{[]string{"SPOP", "myset"}, r.ToBulkString("a")},
+		{[]string{"EXISTS", "myset"}, r.ToInteger(0)},
+	})
+}
+
+func TestSRANDMEMBER(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"SADD", "myset", "a", "b", "c"}))
+	assert.Equal(t, r.ToInteger(3), readBuffer(client))
+
+	// members are distinct with a positive count
+	client.Write(r.ToArray([]string{"SRANDMEMBER", "myset", "2"}))
+	members := readRange(client, 2)
+	assert.NotEqual(t, members[0], members[1])
+	assert.Subset(t, []string{"a", "b", "c"}, members)
+	client.Write(r.ToArray([]string{"SRANDMEMBER", "myset", "5"}))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, readRange(client, 3))
+
+	// and may repeat with a negative one
+	client.Write(r.ToArray([]string{"SRANDMEMBER", "myset", "-10"}))
+	members = readRange(client, 10)
+	assert.Subset(t, []string{"a", "b", "c"}, members)
+
+	runCases(t, client, []testCase{
+		{[]string{"SCARD", "myset"}, r.ToInteger(3)},
+		{[]string{"SRANDMEMBER", "myset", "0"}, r.ToArray([]string{})},
+		{[]string{"SRANDMEMBER", "missing"}, r.ToNullBulkString()},
+		{[]string{"SRANDMEMBER", "missing", "-5"}, r.ToArray([]string{})},
+		{[]string{"SRANDMEMBER", "myset", "-9223372036854775808"}, r.ToSimpleError("ERR value is out of range")},
+		{[]string{"SRANDMEMBER", "myset", "x"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"SADD", "single", "only"}, r.ToInteger(1)},
+		{[]string{"SRANDMEMBER", "single"}, r.ToBulkString("only")},
+		{[]string{"SRANDMEMBER", "single", "-2"}, r.ToArray([]string{"only", "only"})},
+	})
+}
+
+func TestSMOVE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SADD", "myset", "one", "two"}, r.ToInteger(2)},
+		{[]string{"SADD", "myotherset", "three"}, r.ToInteger(1)},
+		{[]string{"SMOVE", "myset", "myotherset", "two"}, r.ToInteger(1)},
+		{[]string{"SMOVE", "myset", "myotherset", "four"}, r.ToInteger(0)},
+		{[]string{"SMOVE", "missing", "myotherset", "two"}, r.ToInteger(0)},
+		{[]string{"SMOVE", "myset", "myset", "one"}, r.ToInteger(1)},
+		{[]string{"SMEMBERS", "myset"}, r.ToArray([]string{"one"})},
+		// the source is deleted with its last member
+		{[]string{"SMOVE", "myset", "newset", "one"}, r.ToInteger(1)},
+		{[]string{"EXISTS", "myset"}, r.ToInteger(0)},
+		{[]string{"SMEMBERS", "newset"}, r.ToArray([]string{"one"})},
+		{[]string{"SCARD", "myotherset"}, r.ToInteger(2)},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"SMOVE", "myotherset", "string", "two"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"SMOVE", "string", "myotherset", "two"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestSINTER(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"SADD", "key1", "a", "b", "c", "d"}))
+	assert.Equal(t, r.ToInteger(4), readBuffer(client))
+	client.Write(r.ToArray([]string{"SADD", "key2", "c"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"SADD", "key3", "a", "c", "e"}))
+	assert.Equal(t, r.ToInteger(3), readBuffer(client))
+
+	client.Write(r.ToArray([]string{"SINTER", "key1", "key3"}))
+	assert.ElementsMatch(t, []string{"a", "c"}, readRange(client, 2))
+	client.Write(r.ToArray([]string{"SUNION", "key1", "key2", "key3", "missing"}))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, readRange(client, 5))
+	client.Write(r.ToArray([]string{"SDIFF", "key1", "key2", "key3"}))
+	assert.ElementsMatch(t, []string{"b", "d"}, readRange(client, 2))
+	client.Write(r.ToArray([]string{"SINTERSTORE", "dest", "key1", "key3"}))
+	assert.Equal(t, r.ToInteger(2), readBuffer(client))
+	client.Write(r.ToArray([]string{"SMEMBERS", "dest"}))
+	assert.ElementsMatch(t, []string{"a", "c"}, readRange(client, 2))
+
+	runCases(t, client, []testCase{
+		{[]string{"SINTER", "key1", "key2", "key3"}, r.ToArray([]string{"c"})},
+		{[]string{"SINTER", "key1", "missing"}, r.ToArray([]string{})},
+		{[]string{"SDIFF", "missing", "key1"}, r.ToArray([]string{})},
+		{[]string{"SDIFF", "key2", "key1"}, r.ToArray([]string{})},
+		{[]string{"SUNIONSTORE", "dest", "key2", "missing"}, r.ToInteger(1)},
+		{[]string{"SMEMBERS", "dest"}, r.ToArray([]string{"c"})},
+		{[]string{"SDIFFSTORE", "dest", "key3", "key1"}, r.ToInteger(1)},
+		{[]string{"SMEMBERS", "dest"}, r.ToArray([]string{"e"})},
+		// an empty result deletes the destination
+		{[]string{"SINTERSTORE", "dest", "key2", "missing"}, r.ToInteger(0)},
+		{[]string{"EXISTS", "dest"}, r.ToInteger(0)},
+		// the destination is overwritten whatever its type
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"SUNIONSTORE", "string", "key2"}, r.ToInteger(1)},
+		{[]string{"SMEMBERS", "string"}, r.ToArray([]string{"c"})},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"SINTER", "key1", "string"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"SUNIONSTORE", "dest", "key1", "string"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+}
+
+func TestSINTERCARD(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"SADD", "key1", "a", "b", "c", "d"}, r.ToInteger(4)},
+		{[]string{"SADD", "key2", "c", "d", "e"}, r.ToInteger(3)},
+		{[]string{"SINTERCARD", "2", "key1", "key2"}, r.ToInteger(2)},
+		{[]string{"SINTERCARD", "2", "key1", "key2", "LIMIT", "1"}, r.ToInteger(1)},
+		{[]string{"SINTERCARD", "2", "key1", "key2", "LIMIT", "0"}, r.ToInteger(2)},
+		{[]string{"SINTERCARD", "1", "key1"}, r.ToInteger(4)},
+		{[]string{"SINTERCARD", "2", "key1", "missing"}, r.ToInteger(0)},
+		{[]string{"SINTERCARD", "0", "key1"}, r.ToSimpleError("ERR numkeys should be greater than 0")},
+		{[]string{"SINTERCARD", "3", "key1", "key2"}, r.ToSimpleError("ERR Number of keys can't be greater than number of args")},
+		{[]string{"SINTERCARD", "2", "key1", "key2", "LIMIT", "-1"}, r.ToSimpleError("ERR LIMIT can't be negative")},
+		{[]string{"SINTERCARD", "1", "key1", "LIMIT", "+5"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"SINTERCARD", "1", "key1", "key2"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"COMMAND", "GETKEYS", "SINTERCARD", "2", "key1", "key2", "LIMIT", "1"}, r.ToArray([]string{"key1", "key2"})},
+	})
+}
+
+func TestZADD(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "myzset", "1", "one"}, r.ToInteger(1)},
+		{[]string{"ZADD", "myzset", "1", "uno", "2", "two", "3", "two"}, r.ToInteger(2)},
+		{[]string{"ZSCORE", "myzset", "two"}, r.ToBulkString("3")},
+		{[]string{"ZCARD", "myzset"}, r.ToInteger(3)},
+		{[]string{"ZADD", "myzset", "NX", "10", "one", "4", "four"}, r.ToInteger(1)},
+		{[]string{"ZSCORE", "myzset", "one"}, r.ToBulkString("1")},
+		{[]string{"ZADD", "myzset", "XX", "CH", "10", "one", "5", "five"}, r.ToInteger(1)},
+		{[]string{"ZSCORE", "myzset", "five"}, r.ToNullBulkString()},
+		{[]string{"ZADD", "myzset", "GT", "CH", "5", "one", "5", "two"}, r.ToInteger(1)},
+		{[]string{"ZADD", "myzset", "LT", "CH", "20", "one", "1", "two"}, r.ToInteger(1)},
+		{[]string{"ZMSCORE", "myzset", "one", "two", "nofield"}, []byte("*3\r\n$2\r\n10\r\n$1\r\n1\r\n$-1\r\n")},
+		{[]string{"ZADD", "myzset", "INCR", "2.5", "one"}, r.ToBulkString("12.5")},
+		{[]string{"ZADD", "myzset", "NX", "INCR", "1", "one"}, r.ToNullBulkString()},
+		{[]string{"ZADD", "myzset", "GT", "INCR", "-1", "one"}, r.ToNullBulkString()},
+		{[]string{"ZINCRBY", "myzset", "-0.5", "one"}, r.ToBulkString("12")},
+		{[]string{"ZINCRBY", "myzset", "7", "new"}, r.ToBulkString("7")},
+		{[]string{"ZADD", "myzset", "+inf", "big", "-inf", "small", "1e-7", "tiny"}, r.ToInteger(3)},
+		{[]string{"ZMSCORE", "myzset", "big", "small", "tiny"}, []byte("*3\r\n$3\r\ninf\r\n$4\r\n-inf\r\n$4\r\n1e-7\r\n")},
+		{[]string{"ZINCRBY", "myzset", "-inf", "big"}, r.ToSimpleError("ERR resulting score is not a number (NaN)")},
+		{[]string{"ZADD", "myzset", "nan", "one"}, r.ToSimpleError("ERR value is not a valid float")},
+		{[]string{"ZADD", "myzset", "1", "one", "2"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZADD", "myzset", "NX", "XX", "1", "one"}, r.ToSimpleError("ERR XX and NX options at the same time are not compatible")},
+		{[]string{"ZADD", "myzset", "GT", "LT", "1", "one"}, r.ToSimpleError("ERR GT, LT, and/or NX options at the same time are not compatible")},
+		{[]string{"ZADD", "myzset", "INCR", "1", "one", "2", "two"}, r.ToSimpleError("ERR INCR option supports a single increment-element pair")},
+		{[]string{"ZADD", "missing", "XX", "1", "one"}, r.ToInteger(0)},
+		{[]string{"EXISTS", "missing"}, r.ToInteger(0)},
+		{[]string{"ZREM", "myzset", "one", "two", "nofield"}, r.ToInteger(2)},
+		{[]string{"ZCARD", "myzset"}, r.ToInteger(6)},
+		{[]string{"ZREM", "myzset", "uno", "four", "new", "big", "small", "tiny"}, r.ToInteger(6)},
+		{[]string{"EXISTS", "myzset"}, r.ToInteger(0)},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"ZADD", "string", "1", "one"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"ZSCORE", "string", "one"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	})
+
+	// RESP3 clients get doubles
+	client.Write(r.ToArray([]string{"HELLO", "3"}))
+	readBuffer(client)
+	client.Write(r.ToArray([]string{"ZADD", "myzset", "1.5", "one"}))
+	assert.Equal(t, r.ToInteger(1), readBuffer(client))
+	client.Write(r.ToArray([]string{"ZSCORE", "myzset", "one"}))
+	assert.Equal(t, r.ToDouble(1.5), readBuffer(client))
+}
+
+func TestZSCOREExponent(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// exponents aren't padded with zeros
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "myzset", "0.0000001", "small", "1e30", "large", "-2.5e-10", "negative"}, r.ToInteger(3)},
+		{[]string{"ZSCORE", "myzset", "small"}, r.ToBulkString("1e-7")},
+		{[]string{"ZSCORE", "myzset", "large"}, r.ToBulkString("1e+30")},
+		{[]string{"ZSCORE", "myzset", "negative"}, r.ToBulkString("-2.5e-10")},
+		{[]string{"ZINCRBY", "myzset", "1e100", "large"}, r.ToBulkString("1e+100")},
+	})
+}
+
+func TestZRANK(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "myzset", "1", "one", "2", "two", "3", "three"}, r.ToInteger(3)},
+		{[]string{"ZRANK", "myzset", "three"}, r.ToInteger(2)},
+		{[]string{"ZREVRANK", "myzset", "three"}, r.ToInteger(0)},
+		{[]string{"ZRANK", "myzset", "four"}, r.ToNullBulkString()},
+		{[]string{"ZRANK", "myzset", "two", "WITHSCORE"}, []byte("*2\r\n:1\r\n$1\r\n2\r\n")},
+		{[]string{"ZREVRANK", "myzset", "one", "WITHSCORE"}, []byte("*2\r\n:2\r\n$1\r\n1\r\n")},
+		{[]string{"ZRANK", "myzset", "four", "WITHSCORE"}, r.ToNullArray()},
+		{[]string{"ZRANK", "myzset", "two", "WITHSCORES"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZCOUNT", "myzset", "-inf", "+inf"}, r.ToInteger(3)},
+		{[]string{"ZCOUNT", "myzset", "(1", "3"}, r.ToInteger(2)},
+		{[]string{"ZCOUNT", "myzset", "(1", "(3"}, r.ToInteger(1)},
+		{[]string{"ZCOUNT", "myzset", "4", "10"}, r.ToInteger(0)},
+		{[]string{"ZCOUNT", "myzset", "3", "1"}, r.ToInteger(0)},
+		{[]string{"ZCOUNT", "missing", "1", "3"}, r.ToInteger(0)},
+		{[]string{"ZCOUNT", "myzset", "one", "3"}, r.ToSimpleError("ERR min or max is not a float")},
+	})
+}
+
+func TestZRANGE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "myzset", "1", "one", "2", "two", "3", "three", "3", "drei"}, r.ToInteger(4)},
+		// members with the same score are ordered lexicographically
+		{[]string{"ZRANGE", "myzset", "0", "-1"}, r.ToArray([]string{"one", "two", "drei", "three"})},
+		{[]string{"ZRANGE", "myzset", "-2", "-1"}, r.ToArray([]string{"drei", "three"})},
+		{[]string{"ZRANGE", "myzset", "0", "1", "REV"}, r.ToArray([]string{"three", "drei"})},
+		{[]string{"ZRANGE", "myzset", "5", "10"}, r.ToArray([]string{})},
+		{[]string{"ZRANGE", "myzset", "0", "1", "WITHSCORES"}, r.ToArray([]string{"one", "1", "two", "2"})},
+		{[]string{"ZRANGE", "myzset", "(1", "+inf", "BYSCORE"}, r.ToArray([]string{"two", "drei", "three"})},
+		{[]string{"ZRANGE", "myzset", "+inf", "(1", "BYSCORE", "REV"}, r.ToArray([]string{"three", "drei", "two"})},
+		{[]string{"ZRANGE", "myzset", "-inf", "+inf", "BYSCORE", "LIMIT", "1", "2"}, r.ToArray([]string{"two", "drei"})},
+		{[]string{"ZRANGE", "myzset", "-inf", "+inf", "BYSCORE", "LIMIT", "3", "-1"}, r.ToArray([]string{"three"})},
+		{[]string{"ZRANGE", "myzset", "-inf", "+inf", "BYSCORE", "LIMIT", "-1", "2"}, r.ToArray([]string{})},
+		{[]string{"ZRANGE", "myzset", "2", "1", "BYSCORE"}, r.ToArray([]string{})},
+		{[]string{"ZRANGE", "myzset", "0", "-1", "LIMIT", "0", "1"}, r.ToSimpleError("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")},
+		{[]string{"ZRANGE", "myzset", "-", "+", "BYLEX", "WITHSCORES"}, r.ToSimpleError("ERR syntax error, WITHSCORES not supported in combination with BYLEX")},
+		{[]string{"ZRANGE", "myzset", "a", "1", "BYSCORE"}, r.ToSimpleError("ERR min or max is not a float")},
+		{[]string{"ZRANGE", "myzset", "a", "1"}, r.ToSimpleError("ERR value is not an integer or out of range")},
+		{[]string{"ZRANGE", "myzset", "0", "1", "FOO"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZRANGE", "missing", "0", "-1"}, r.ToArray([]string{})},
+		{[]string{"ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d", "0", "e"}, r.ToInteger(5)},
+		{[]string{"ZRANGE", "lex", "-", "[c", "BYLEX"}, r.ToArray([]string{"a", "b", "c"})},
+		{[]string{"ZRANGE", "lex", "(b", "+", "BYLEX", "LIMIT", "1", "2"}, r.ToArray([]string{"d", "e"})},
+		{[]string{"ZRANGE", "lex", "(d", "[b", "BYLEX", "REV"}, r.ToArray([]string{"c", "b"})},
+		{[]string{"ZRANGE", "lex", "+", "-", "BYLEX"}, r.ToArray([]string{})},
+		{[]string{"ZRANGE", "lex", "a", "[c", "BYLEX"}, r.ToSimpleError("ERR min or max not valid string range item")},
+	})
+
+	// RESP3 clients get member-score pairs
+	client.Write(r.ToArray([]string{"HELLO", "3"}))
+	readBuffer(client)
+	client.Write(r.ToArray([]string{"ZRANGE", "myzset", "0", "0", "WITHSCORES"}))
+	assert.Equal(t, []byte("*1\r\n*2\r\n$3\r\none\r\n,1\r\n"), readBuffer(client))
+}
+
+func TestZsetOrder(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// the skiplist stays ordered through inserts, updates and deletes
+	const members = 500
+	scores := map[string]int{}
+	for i := 0; i < 3*members; i++ {
+		member := strconv.Itoa(i % members)
+		score := (i * 7919) % 1000
+		client.Write(r.ToArray([]string{"ZADD", "myzset", strconv.Itoa(score), member}))
+		readBuffer(client)
+		scores[member] = score
+	}
+	for i := 0; i < members; i += 3 {
+		client.Write(r.ToArray([]string{"ZREM", "myzset", strconv.Itoa(i)}))
+		assert.Equal(t, r.ToInteger(1), readBuffer(client))
+		delete(scores, strconv.Itoa(i))
+	}
+
+	expected := make([]string, 0, len(scores))
+	for member := range scores {
+		expected = append(expected, member)
+	}
+	slices.SortFunc(expected, func(a, b string) int {
+		if scores[a] != scores[b] {
+			return scores[a] - scores[b]
+		}
+		return strings.Compare(a, b)
+	})
+
+	client.Write(r.ToArray([]string{"ZRANGE", "myzset", "0", "-1"}))
+	assert.Equal(t, expected, readRange(client, len(expected)))
+	for _, rank := range []int{0, 1, len(expected) / 2, len(expected) - 1} {
+		client.Write(r.ToArray([]string{"ZRANK", "myzset", expected[rank]}))
+		assert.Equal(t, r.ToInteger(rank), readBuffer(client))
+		client.Write(r.ToArray([]string{"ZRANGE", "myzset", strconv.Itoa(rank), strconv.Itoa(rank)}))
+		assert.Equal(t, r.ToArray([]string{expected[rank]}), readBuffer(client))
+	}
+}
+
+func TestZUNION(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "zset1", "1", "one", "2", "two"}, r.ToInteger(2)},
+		{[]string{"ZADD", "zset2", "1", "one", "2", "two", "3", "three"}, r.ToInteger(3)},
+		{[]string{"ZUNION", "2", "zset1", "zset2"}, r.ToArray([]string{"one", "three", "two"})},
+		{[]string{"ZUNION", "2", "zset1", "zset2", "WITHSCORES"}, r.ToArray([]string{"one", "2", "three", "3", "two", "4"})},
+		{[]string{"ZINTER", "2", "zset1", "zset2", "WITHSCORES"}, r.ToArray([]string{"one", "2", "two", "4"})},
+		{[]string{"ZINTER", "2", "zset1", "zset2", "AGGREGATE", "MAX", "WITHSCORES"}, r.ToArray([]string{"one", "1", "two", "2"})},
+		{[]string{"ZUNION", "2", "zset1", "zset2", "WEIGHTS", "2", "3", "AGGREGATE", "MIN", "WITHSCORES"}, r.ToArray([]string{"one", "2", "two", "4", "three", "9"})},
+		{[]string{"ZDIFF", "2", "zset2", "zset1", "WITHSCORES"}, r.ToArray([]string{"three", "3"})},
+		{[]string{"ZDIFF", "2", "missing", "zset1"}, r.ToArray([]string{})},
+		{[]string{"ZINTER", "2", "zset1", "missing"}, r.ToArray([]string{})},
+		// sets are sorted sets whose members score 1
+		{[]string{"SADD", "set", "two", "four"}, r.ToInteger(2)},
+		{[]string{"ZUNION", "2", "zset1", "set", "WITHSCORES"}, r.ToArray([]string{"four", "1", "one", "1", "two", "3"})},
+		// NaN (inf - inf, 0 * inf) counts as 0
+		{[]string{"ZADD", "inf", "+inf", "one"}, r.ToInteger(1)},
+		{[]string{"ZADD", "neginf", "-inf", "one"}, r.ToInteger(1)},
+		{[]string{"ZUNION", "2", "inf", "neginf", "WITHSCORES"}, r.ToArray([]string{"one", "0"})},
+		{[]string{"ZUNION", "1", "inf", "WEIGHTS", "0", "WITHSCORES"}, r.ToArray([]string{"one", "0"})},
+		{[]string{"ZUNION", "0", "zset1"}, r.ToSimpleError("ERR at least 1 input key is needed for 'zunion' command")},
+		{[]string{"ZUNION", "3", "zset1", "zset2"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZUNION", "2", "zset1", "zset2", "WEIGHTS", "1"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZUNION", "2", "zset1", "zset2", "WEIGHTS", "1", "x"}, r.ToSimpleError("ERR weight value is not a float")},
+		{[]string{"ZUNION", "2", "zset1", "zset2", "AGGREGATE", "AVG"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZDIFF", "2", "zset1", "zset2", "WEIGHTS", "1", "2"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"SET", "string", "value"}, r.ToSimpleString("OK")},
+		{[]string{"ZUNION", "2", "zset1", "string"}, r.ToSimpleError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"COMMAND", "GETKEYS", "ZUNION", "2", "zset1", "zset2", "WITHSCORES"}, r.ToArray([]string{"zset1", "zset2"})},
+	})
+}
+
+func TestZUNIONSTORE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "zset1", "1", "one", "2", "two"}, r.ToInteger(2)},
+		{[]string{"ZADD", "zset2", "1", "one", "2", "two", "3", "three"}, r.ToInteger(3)},
+		{[]string{"ZUNIONSTORE", "out", "2", "zset1", "zset2", "WEIGHTS", "2", "3"}, r.ToInteger(3)},
+		{[]string{"ZRANGE", "out", "0", "-1", "WITHSCORES"}, r.ToArray([]string{"one", "5", "three", "9", "two", "10"})},
+		{[]string{"ZINTERSTORE", "out", "2", "zset1", "zset2"}, r.ToInteger(2)},
+		{[]string{"ZRANGE", "out", "0", "-1", "WITHSCORES"}, r.ToArray([]string{"one", "2", "two", "4"})},
+		{[]string{"ZDIFFSTORE", "out", "2", "zset2", "zset1"}, r.ToInteger(1)},
+		{[]string{"ZRANGE", "out", "0", "-1", "WITHSCORES"}, r.ToArray([]string{"three", "3"})},
+		// an empty result deletes the destination
+		{[]string{"ZINTERSTORE", "out", "2", "zset1", "missing"}, r.ToInteger(0)},
+		{[]string{"EXISTS", "out"}, r.ToInteger(0)},
+		{[]string{"ZUNIONSTORE", "out", "1", "zset1", "WITHSCORES"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZINTERSTORE", "out", "0", "zset1"}, r.ToSimpleError("ERR at least 1 input key is needed for 'zinterstore' command")},
+		{[]string{"ZRANGESTORE", "out", "zset2", "1", "-1"}, r.ToInteger(2)},
+		{[]string{"ZRANGE", "out", "0", "-1", "WITHSCORES"}, r.ToArray([]string{"two", "2", "three", "3"})},
+		{[]string{"ZRANGESTORE", "out", "zset2", "+inf", "(1", "BYSCORE", "REV", "LIMIT", "0", "1"}, r.ToInteger(1)},
+		{[]string{"ZRANGE", "out", "0", "-1"}, r.ToArray([]string{"three"})},
+		{[]string{"ZRANGESTORE", "out", "zset2", "5", "10"}, r.ToInteger(0)},
+		{[]string{"EXISTS", "out"}, r.ToInteger(0)},
+		{[]string{"ZRANGESTORE", "out", "zset2", "0", "-1", "WITHSCORES"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"COMMAND", "GETKEYS", "ZUNIONSTORE", "out", "2", "zset1", "zset2"}, r.ToArray([]string{"out", "zset1", "zset2"})},
+	})
+}
+
+func TestZPOPMIN(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	runCases(t, client, []testCase{
+		{[]string{"ZADD", "myzset", "1", "one", "2", "two", "3", "three", "4", "four"}, r.ToInteger(4)},
+		{[]string{"ZPOPMIN", "myzset"}, r.ToArray([]string{"one", "1"})},
+		{[]string{"ZPOPMAX", "myzset"}, r.ToArray([]string{"four", "4"})},
+		{[]string{"ZPOPMIN", "myzset", "0"}, r.ToArray([]string{})},
+		{[]string{"ZPOPMAX", "myzset", "5"}, r.ToArray([]string{"three", "3", "two", "2"})},
+		{[]string{"EXISTS", "myzset"}, r.ToInteger(0)},
+		{[]string{"ZPOPMIN", "myzset"}, r.ToArray([]string{})},
+		{[]string{"ZPOPMIN", "myzset", "-1"}, r.ToSimpleError("ERR value is out of range, must be positive")},
+		{[]string{"ZADD", "zset2", "1", "a", "2", "b", "3", "c"}, r.ToInteger(3)},
+		{[]string{"ZMPOP", "2", "myzset", "zset2", "MIN"}, []byte("*2\r\n$5\r\nzset2\r\n*1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n")},
+		{[]string{"ZMPOP", "2", "myzset", "zset2", "MAX", "COUNT", "10"}, []byte("*2\r\n$5\r\nzset2\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n")},
+		{[]string{"ZMPOP", "2", "myzset", "zset2", "MIN"}, r.ToNullArray()},
+		{[]string{"ZMPOP", "1", "myzset", "LEFT"}, r.ToSimpleError("ERR syntax error")},
+		{[]string{"ZMPOP", "0", "myzset", "MIN"}, r.ToSimpleError("ERR numkeys should be greater than 0")},
+		{[]string{"ZMPOP", "1", "myzset", "MIN", "COUNT", "0"}, r.ToSimpleError("ERR count should be greater than 0")},
+	})
+
+	// RESP3 clients get member-score pairs with a count
+	client.Write(r.ToArray([]string{"HELLO", "3"}))
+	readBuffer(client)
+	client.Write(r.ToArray([]string{"ZADD", "myzset", "1", "one", "2", "two"}))
+	assert.Equal(t, r.ToInteger(2), readBuffer(client))
+	client.Write(r.ToArray([]string{"ZPOPMIN", "myzset"}))
+	assert.Equal(t, []byte("*2\r\n$3\r\none\r\n,1\r\n"), readBuffer(client))
+	client.Write(r.ToArray([]string{"ZPOPMIN", "myzset", "1"}))
+	assert.Equal(t, []byte("*1\r\n*2\r\n$3\r\ntwo\r\n,2\r\n"), readBuffer(client))
 }
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	concurrentClients = 20
+	commandsPerClient = 200
+)
+
+// runs fn on concurrentClients connections at the same time
+func concurrently(fn func(id int, client net.Conn)) {
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentClients; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			client := connect()
+			defer client.Close()
+			fn(id, client)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// pipelines commands and waits for all of their replies
+func pipeline(client net.Conn, commands [][]string) {
+	var message []byte
+	for _, command := range commands {
+		message = append(message, r.ToArray(command)...)
+	}
+	go client.Write(message)
+
+	reader := bufio.NewReader(client)
+	for range commands {
+		if err := skipReply(reader); err != nil {
+			fmt.Printf("Issue Reading: %s\n", err.Error())
+			return
+		}
+	}
+}
+
+// skipReply reads a whole RESP reply, which may span several lines
+func skipReply(reader *bufio.Reader) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return err
+		}
+		// the value and its \r\n
+		_, err = reader.Discard(length + 2)
+		return err
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < length; i++ {
+			if err := skipReply(reader); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestConcurrentINCR(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	concurrently(func(_ int, client net.Conn) {
+		var commands [][]string
+		for i := 0; i < commandsPerClient; i++ {
+			commands = append(commands, []string{"INCR", "counter"}, []string{"DECR", "other"})
+		}
+		pipeline(client, commands)
+	})
+
+	// no update was lost
+	client.Write(r.ToArray([]string{"GET", "counter"}))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToBulkString(strconv.Itoa(concurrentClients*commandsPerClient)), response)
+
+	client.Write(r.ToArray([]string{"GET", "other"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString(strconv.Itoa(-concurrentClients*commandsPerClient)), response)
+}
+
+func TestConcurrentPush(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	concurrently(func(id int, client net.Conn) {
+		var commands [][]string
+		for i := 0; i < commandsPerClient; i++ {
+			command := "RPUSH"
+			if i%2 == 0 {
+				command = "LPUSH"
+			}
+			commands = append(commands, []string{command, "list", strconv.Itoa(id), strconv.Itoa(i)})
+		}
+		pipeline(client, commands)
+	})
+
+	// no element was dropped
+	client.Write(r.ToArray([]string{"RPUSH", "list", "last"}))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(2*concurrentClients*commandsPerClient+1), response)
+}
+
+// reads the elements of an LRANGE reply of length elements
+func readRange(client net.Conn, length int) []string {
+	// the header, then the length and the value of each element
+	var reply []byte
+	for bytes.Count(reply, []byte("\r\n")) < 1+2*length {
+		reply = append(reply, readBuffer(client)...)
+	}
+	lines := bytes.Split(reply, []byte("\r\n"))
+	elements := []string{}
+	for i := 2; i < len(lines); i += 2 {
+		elements = append(elements, string(lines[i]))
+	}
+	return elements
+}
+
+func TestConcurrentLMOVE(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	const jobs = concurrentClients * commandsPerClient
+	args := []string{"RPUSH", "pending"}
+	for i := 0; i < jobs; i++ {
+		args = append(args, strconv.Itoa(i))
+	}
+	client.Write(r.ToArray(args))
+	readBuffer(client)
+
+	// workers move jobs to processing and back, no job is ever lost or seen
+	// twice
+	concurrently(func(id int, client net.Conn) {
+		var commands [][]string
+		for i := 0; i < commandsPerClient; i++ {
+			commands = append(commands, []string{"LMOVE", "pending", "processing", "LEFT", "RIGHT"})
+			if i%2 == 0 {
+				commands = append(commands, []string{"RPOPLPUSH", "processing", "pending"})
+			}
+		}
+		pipeline(client, commands)
+	})
+
+	seen := map[string]int{}
+	for _, key := range []string{"pending", "processing"} {
+		client.Write(r.ToArray([]string{"LLEN", key}))
+		length, _ := strconv.Atoi(string(bytes.Trim(readBuffer(client), ":\r\n")))
+		// every worker moved half of its jobs back
+		if key == "processing" {
+			assert.Equal(t, jobs/2, length)
+		}
+		client.Write(r.ToArray([]string{"LRANGE", key, "0", "-1"}))
+		for _, element := range readRange(client, length) {
+			seen[element]++
+		}
+	}
+	assert.Len(t, seen, jobs)
+	for element, count := range seen {
+		assert.Equal(t, 1, count, element)
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+	"github.com/C41M50N/Redis-Server-Lite/internal/utils"
+)
+
+// elements in the list the benchmarks run against
+const benchListLen = 100_000
+
+// runs a command against the store directly, skipping the network
+func execute(b *testing.B, client *utils.Client, w *r.Writer, args ...string) {
+	utils.Execute(client, w, args)
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// prepares a list of benchListLen elements at key
+func benchList(b *testing.B, key string) (*utils.Client, *r.Writer) {
+	utils.FlushDB()
+	client := &utils.Client{}
+	w := r.NewWriter(io.Discard)
+	args := []string{"RPUSH", key}
+	for i := 0; i < benchListLen; i++ {
+		args = append(args, strconv.Itoa(i))
+	}
+	execute(b, client, w, args...)
+	b.ResetTimer()
+	return client, w
+}
+
+func BenchmarkLPUSH(b *testing.B) {
+	client, w := benchList(b, "list")
+	for i := 0; i < b.N; i++ {
+		// the list keeps its length
+		execute(b, client, w, "LPUSH", "list", "element")
+		execute(b, client, w, "RPOP", "list")
+	}
+}
+
+func BenchmarkRPUSH(b *testing.B) {
+	client, w := benchList(b, "list")
+	for i := 0; i < b.N; i++ {
+		execute(b, client, w, "RPUSH", "list", "element")
+		execute(b, client, w, "LPOP", "list")
+	}
+}
+
+func BenchmarkLINDEX(b *testing.B) {
+	client, w := benchList(b, "list")
+	for i := 0; i < b.N; i++ {
+		execute(b, client, w, "LINDEX", "list", "50000")
+	}
+}
+
+func BenchmarkLRANGE(b *testing.B) {
+	client, w := benchList(b, "list")
+	for i := 0; i < b.N; i++ {
+		execute(b, client, w, "LRANGE", "list", "50000", "50099")
+	}
+}
@@ -0,0 +1,378 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/C41M50N/Redis-Server-Lite/internal/r"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLargeValue(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	value := strings.Repeat("0123456789", 10_000)
+	args := []string{"SET", "large", value}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"GET", "large"}
+	client.Write(r.ToArray(args))
+	expected := r.ToBulkString(value)
+	response = readBytes(client, len(expected))
+	assert.Equal(t, expected, response)
+}
+
+func TestSplitCommand(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	message := r.ToArray([]string{"ECHO", "split across several reads"})
+	for _, chunk := range [][]byte{message[:3], message[3:11], message[11:30], message[30:]} {
+		client.Write(chunk)
+		time.Sleep(10 * time.Millisecond)
+	}
+	response := readBuffer(client)
+	assert.Equal(t, r.ToBulkString("split across several reads"), response)
+}
+
+func TestProtocolError1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte("*1\r\n$abc\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Protocol error: invalid bulk length"), response)
+
+	// the server hangs up after a protocol error
+	_, err := client.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestProtocolError2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte("*2\r\n$4\r\nECHO\r\n:1\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Protocol error: expected '$', got ':'"), response)
+}
+
+func TestProtocolError3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte("*x\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Protocol error: invalid multibulk length"), response)
+}
+
+func TestPipeline1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	var message []byte
+	message = append(message, r.ToArray([]string{"SET", "counter", "41"})...)
+	message = append(message, r.ToArray([]string{"INCR", "counter"})...)
+	message = append(message, r.ToArray([]string{"GET", "counter"})...)
+	message = append(message, r.ToArray([]string{"PING"})...)
+	client.Write(message)
+
+	var expected []byte
+	expected = append(expected, r.ToSimpleString("OK")...)
+	expected = append(expected, r.ToInteger(42)...)
+	expected = append(expected, r.ToBulkString("42")...)
+	expected = append(expected, r.ToBulkString("PONG")...)
+
+	// every reply is flushed together
+	response := readBuffer(client)
+	assert.Equal(t, expected, response)
+}
+
+func TestPipeline2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// the CONFIG requests redis-benchmark sends before benchmarking
+	client.Write([]byte("*3\r\n$6\r\nCONFIG\r\n$3\r\nGET\r\n$4\r\nsave\r\n*3\r\n$6\r\nCONFIG\r\n$3\r\nGET\r\n$10\r\nappendonly\r\n"))
+	expected := append(r.ToSimpleError("ERR unknown command 'CONFIG'"), r.ToSimpleError("ERR unknown command 'CONFIG'")...)
+	response := readBuffer(client)
+	assert.Equal(t, expected, response)
+
+	// and the session carries on
+	client.Write(r.ToArray([]string{"PING"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("PONG"), response)
+}
+
+func TestPipeline3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// a reply isn't held back by the start of the next command
+	client.Write([]byte("*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPI"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToBulkString("PONG"), response)
+
+	client.Write([]byte("NG\r\n"))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("PONG"), response)
+}
+
+func TestBinaryValue1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// embedded CRLF, NUL and bytes that aren't valid UTF-8
+	value := "line1\r\nline2\x00\x01\xff\xfe\r\n*2\r\n$3\r\n"
+	args := []string{"SET", "blob", value}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"GET", "blob"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString(value), response)
+	assert.Equal(t, []byte("$26\r\n"+value+"\r\n"), response)
+}
+
+func TestBinaryValue2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	elements := []string{"\r\n", "\x00", "a\r\nb", ""}
+	args := append([]string{"RPUSH", "blobs"}, elements...)
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToInteger(4), response)
+
+	args = []string{"LRANGE", "blobs", "0", "-1"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToArray(elements), response)
+}
+
+func TestBinaryKey(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	key := "key\r\nwith\x00crlf"
+	args := []string{"SET", key, "value"}
+	client.Write(r.ToArray(args))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	args = []string{"EXISTS", "key"}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToInteger(0), response)
+
+	args = []string{"GET", key}
+	client.Write(r.ToArray(args))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("value"), response)
+}
+
+func TestInlineCommand1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte("PING\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToBulkString("PONG"), response)
+
+	// netcat only sends LF
+	client.Write([]byte("  ECHO   hello  \n"))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("hello"), response)
+}
+
+func TestInlineCommand2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte(`SET "greeting key" "hello\r\n\x00world" ` + "\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleString("OK"), response)
+
+	client.Write([]byte(`GET 'greeting key'` + "\r\n"))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString("hello\r\n\x00world"), response)
+
+	client.Write([]byte(`ECHO 'it\'s "quoted"'` + "\r\n"))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToBulkString(`it's "quoted"`), response)
+}
+
+func TestInlineCommand3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// blank lines are skipped and inline commands can be pipelined with RESP ones
+	message := append([]byte("\r\nINCR visits\r\n"), r.ToArray([]string{"INCR", "visits"})...)
+	message = append(message, "GET visits\n"...)
+	client.Write(message)
+
+	var expected []byte
+	expected = append(expected, r.ToInteger(1)...)
+	expected = append(expected, r.ToInteger(2)...)
+	expected = append(expected, r.ToBulkString("2")...)
+	response := readBuffer(client)
+	assert.Equal(t, expected, response)
+}
+
+func TestInlineCommand4(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte("ECHO \"unterminated\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Protocol error: unbalanced quotes in request"), response)
+}
+
+func TestInlineCommand5(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write([]byte("ECHO \"closed\"early\r\n"))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Protocol error: unbalanced quotes in request"), response)
+}
+
+func TestHello1(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	// RESP2 is spoken until the client asks for something else
+	client.Write(r.ToArray([]string{"GET", "missing"}))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+
+	client.Write(r.ToArray([]string{"HELLO", "3"}))
+	response = readBuffer(client)
+	assert.Equal(t, byte('%'), response[0])
+	assert.Contains(t, string(response), "$5\r\nproto\r\n:3\r\n")
+
+	client.Write(r.ToArray([]string{"GET", "missing"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToNull(), response)
+
+	client.Write(r.ToArray([]string{"HELLO", "2"}))
+	response = readBuffer(client)
+	assert.Equal(t, []byte("*14\r\n"), response[:5])
+	assert.Contains(t, string(response), "$5\r\nproto\r\n:2\r\n")
+
+	client.Write(r.ToArray([]string{"GET", "missing"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+}
+
+func TestHello2(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"HELLO", "4"}))
+	response := readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("NOPROTO unsupported protocol version"), response)
+
+	client.Write(r.ToArray([]string{"HELLO", "three"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Protocol version is not an integer or out of range"), response)
+
+	// a bad option leaves the protocol untouched
+	client.Write(r.ToArray([]string{"HELLO", "3", "SETNAME"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Syntax error in HELLO option 'SETNAME'"), response)
+
+	client.Write(r.ToArray([]string{"HELLO", "3", "AUTH", "admin", "secret"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("WRONGPASS invalid username-password pair or user is disabled."), response)
+
+	client.Write(r.ToArray([]string{"GET", "missing"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToNullBulkString(), response)
+}
+
+func TestHello3(t *testing.T) {
+	client := createMockConnection()
+	defer client.Close()
+
+	client.Write(r.ToArray([]string{"HELLO", "3", "AUTH", "default", "anything", "SETNAME", "worker-1"}))
+	response := readBuffer(client)
+	assert.Equal(t, byte('%'), response[0])
+
+	client.Write(r.ToArray([]string{"HELLO", "2", "SETNAME", "bad name"}))
+	response = readBuffer(client)
+	assert.Equal(t, r.ToSimpleError("ERR Client names cannot contain spaces, newlines or special characters."), response)
+}
+
+func TestRESP3Encoders(t *testing.T) {
+	assert.Equal(t, []byte("%1\r\n$3\r\nkey\r\n:1\r\n"), r.ToMap([]r.Bytes{r.ToBulkString("key"), r.ToInteger(1)}))
+	assert.Equal(t, []byte("~2\r\n$1\r\na\r\n$1\r\nb\r\n"), r.ToSet([]string{"a", "b"}))
+	assert.Equal(t, []byte(">2\r\n$7\r\nmessage\r\n:1\r\n"), r.ToPush([]r.Bytes{r.ToBulkString("message"), r.ToInteger(1)}))
+	assert.Equal(t, []byte(",1.5\r\n"), r.ToDouble(1.5))
+	assert.Equal(t, []byte(",-inf\r\n"), r.ToDouble(math.Inf(-1)))
+	assert.Equal(t, []byte(",nan\r\n"), r.ToDouble(math.NaN()))
+	assert.Equal(t, []byte("#t\r\n"), r.ToBoolean(true))
+	assert.Equal(t, []byte("#f\r\n"), r.ToBoolean(false))
+
+	bigNumber, _ := new(big.Int).SetString("3492890328409238509324850943850943825024385", 10)
+	assert.Equal(t, []byte("(3492890328409238509324850943850943825024385\r\n"), r.ToBigNumber(bigNumber))
+	assert.Equal(t, []byte("=15\r\ntxt:Some string\r\n"), r.ToVerbatimString("txt", "Some string"))
+}
+
+func TestWriter1(t *testing.T) {
+	var buffer bytes.Buffer
+	w := r.NewWriter(&buffer)
+
+	// a nested reply with mixed types, like SCAN's cursor and keys
+	w.WriteArrayHeader(2)
+	w.WriteBulkString("0")
+	w.WriteStringArray([]string{"key1", "key2"})
+	w.WriteInteger(-7)
+	w.WriteError(errors.New("syntax error"))
+	w.WriteError(&r.Error{Code: "WRONGTYPE", Message: "Operation against a key holding the wrong kind of value"})
+	w.WriteNull()
+	assert.Equal(t, 0, buffer.Len())
+
+	w.Flush()
+	expected := "*2\r\n$1\r\n0\r\n*2\r\n$4\r\nkey1\r\n$4\r\nkey2\r\n" +
+		":-7\r\n" +
+		"-ERR syntax error\r\n" +
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n" +
+		"$-1\r\n"
+	assert.Equal(t, expected, buffer.String())
+}
+
+func TestWriter2(t *testing.T) {
+	var buffer bytes.Buffer
+	w := r.NewWriter(&buffer)
+
+	// RESP3 types degrade to their RESP2 equivalents
+	w.WriteMapHeader(1)
+	w.WriteSetHeader(0)
+	w.WriteDouble(2.5)
+	w.WriteBoolean(true)
+	w.WriteNullArray()
+	w.Flush()
+	assert.Equal(t, "*2\r\n*0\r\n$3\r\n2.5\r\n:1\r\n*-1\r\n", buffer.String())
+
+	buffer.Reset()
+	w.Protocol = r.RESP3
+	w.WriteMapHeader(1)
+	w.WriteSetHeader(0)
+	w.WriteDouble(2.5)
+	w.WriteBoolean(true)
+	w.WriteNullArray()
+	w.Flush()
+	assert.Equal(t, "%1\r\n~0\r\n,2.5\r\n#t\r\n_\r\n", buffer.String())
+}